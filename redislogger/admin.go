@@ -0,0 +1,138 @@
+package redislogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(adminStatus{})
+}
+
+// 连接状态
+const (
+	stateConnected    = "connected"
+	stateDisconnected = "disconnected"
+	stateFallback     = "fallback"
+)
+
+// instances 记录当前已加载的 redis_logger 实例，供管理接口查询。
+// 重载配置时新旧实例会短暂地同时存在。
+var instances = struct {
+	mu sync.Mutex
+	m  map[*RedisLogger]struct{}
+}{m: make(map[*RedisLogger]struct{})}
+
+// registerInstance 在 Provision 完成后登记实例
+func registerInstance(rl *RedisLogger) {
+	instances.mu.Lock()
+	defer instances.mu.Unlock()
+	instances.m[rl] = struct{}{}
+}
+
+// unregisterInstance 在 Cleanup 时注销实例
+func unregisterInstance(rl *RedisLogger) {
+	instances.mu.Lock()
+	defer instances.mu.Unlock()
+	delete(instances.m, rl)
+}
+
+// adminStatus 在Caddy管理接口上提供 GET /redis_logger/status，
+// 返回每个 redis_logger 实例的连接状态、写入计数与缓冲队列深度
+type adminStatus struct{}
+
+func (adminStatus) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.redis_logger",
+		New: func() caddy.Module { return new(adminStatus) },
+	}
+}
+
+// Routes 实现了 caddy.AdminRouter
+func (adminStatus) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/redis_logger/status",
+			Handler: caddy.AdminHandlerFunc(handleStatus),
+		},
+	}
+}
+
+// instanceStatus 是管理接口中一个实例的状态
+type instanceStatus struct {
+	RedisKey       string     `json:"redis_key"`
+	RedisAddress   string     `json:"redis_address"`
+	State          string     `json:"state"`
+	LastPing       *time.Time `json:"last_ping,omitempty"`
+	LastPingError  string     `json:"last_ping_error,omitempty"`
+	Pushed         uint64     `json:"pushed"`
+	PushErrors     uint64     `json:"push_errors"`
+	Dropped        uint64     `json:"dropped"`
+	BufferDepth    int        `json:"buffer_depth"`
+	BufferCapacity int        `json:"buffer_capacity"`
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	instances.mu.Lock()
+	statuses := make([]instanceStatus, 0, len(instances.m))
+	for rl := range instances.m {
+		statuses = append(statuses, rl.status())
+	}
+	instances.mu.Unlock()
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].RedisKey < statuses[j].RedisKey
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(statuses)
+}
+
+// status 汇总实例当前的状态。连接状态取最近一次PING的结果，
+// 正在使用备用Redis时为 fallback
+func (rl *RedisLogger) status() instanceStatus {
+	st := instanceStatus{
+		RedisKey:     rl.RedisKey,
+		RedisAddress: rl.displayAddress(),
+		State:        stateDisconnected,
+		Pushed:       rl.metrics.pushedTotal.Load(),
+		PushErrors:   rl.metrics.pushErrorsTotal.Load(),
+		Dropped:      rl.metrics.droppedTotal.Load(),
+	}
+
+	lastPing, pingErr := rl.client.lastPing()
+	if !lastPing.IsZero() {
+		st.LastPing = &lastPing
+	}
+	if pingErr != nil {
+		st.LastPingError = pingErr.Error()
+	} else if !lastPing.IsZero() {
+		st.State = stateConnected
+	}
+	if rl.fallback != nil {
+		if _, ok := rl.activeFallback(); ok {
+			st.State = stateFallback
+		}
+	}
+
+	if rl.buffer != nil {
+		st.BufferDepth = len(rl.buffer.items)
+		st.BufferCapacity = cap(rl.buffer.items)
+	}
+	return st
+}
+
+// Interface guards
+var _ caddy.AdminRouter = (*adminStatus)(nil)
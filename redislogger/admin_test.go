@@ -0,0 +1,88 @@
+package redislogger
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+// adminGet 调用管理接口的状态路由
+func adminGet(t *testing.T, method string) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	routes := adminStatus{}.Routes()
+	if len(routes) != 1 || routes[0].Pattern != "/redis_logger/status" {
+		t.Fatalf("unexpected admin routes %v", routes)
+	}
+	w := httptest.NewRecorder()
+	err := routes[0].Handler.ServeHTTP(w, httptest.NewRequest(method, "/redis_logger/status", nil))
+	return w, err
+}
+
+func TestAdminStatus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	direct := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "admin:direct"
+	})
+	buffered := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "admin:buffered"
+		rl.BufferSize = 8
+		rl.BatchSize = 100
+		rl.FlushInterval = caddy.Duration(time.Hour)
+	})
+	serve(t, direct, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	serve(t, buffered, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+
+	w, err := adminGet(t, http.MethodGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var statuses []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body.String(), err)
+	}
+	byKey := make(map[any]map[string]any)
+	for _, st := range statuses {
+		byKey[st["redis_key"]] = st
+	}
+
+	st := byKey["admin:direct"]
+	if st == nil || st["state"] != stateConnected || st["redis_address"] != mr.Addr() ||
+		st["pushed"] != float64(1) || st["push_errors"] != float64(0) || st["dropped"] != float64(0) {
+		t.Errorf("unexpected status for the direct logger: %v", st)
+	}
+	if _, ok := st["last_ping"].(string); !ok {
+		t.Errorf("last_ping missing from %v", st)
+	}
+	// 缓冲中的日志还没到批量写入的时间
+	st = byKey["admin:buffered"]
+	if st == nil || st["buffer_capacity"] != float64(8) || st["pushed"] != float64(0) {
+		t.Errorf("unexpected status for the buffered logger: %v", st)
+	}
+
+	// 卸载后不再出现
+	if err := cleanup(direct); err != nil {
+		t.Fatal(err)
+	}
+	w, _ = adminGet(t, http.MethodGet)
+	statuses = nil
+	json.Unmarshal(w.Body.Bytes(), &statuses)
+	for _, st := range statuses {
+		if st["redis_key"] == "admin:direct" {
+			t.Error("status still lists a cleaned up logger")
+		}
+	}
+
+	var apiErr caddy.APIError
+	if _, err := adminGet(t, http.MethodPost); !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusMethodNotAllowed {
+		t.Errorf("POST returned %v, want 405", err)
+	}
+}
@@ -0,0 +1,32 @@
+package redislogger
+
+import "net/http"
+
+// authRedactions 返回开启 WithAuthPresent 后需要额外脱敏的名称：
+// 凭据本身绝不能出现在日志中，所以 Authorization 头与 AuthCookies 中的cookie总是打码，
+// 配置了 AuthCookies 时整个 Cookie 头也要打码
+func (rl *RedisLogger) authRedactions() []string {
+	if !rl.WithAuthPresent {
+		return nil
+	}
+	names := []string{"Authorization"}
+	if len(rl.AuthCookies) > 0 {
+		names = append(names, "Cookie")
+		names = append(names, rl.AuthCookies...)
+	}
+	return names
+}
+
+// authPresent 判断请求是否带有凭据：Authorization 头，或 AuthCookies 中任一非空cookie。
+// 只记录有没有，不记录值。
+func (rl *RedisLogger) authPresent(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	for _, name := range rl.AuthCookies {
+		if c, err := r.Cookie(name); err == nil && c.Value != "" {
+			return true
+		}
+	}
+	return false
+}
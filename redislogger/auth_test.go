@@ -0,0 +1,45 @@
+package redislogger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestAuthPresent(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header string
+		cookie string
+		want   bool
+	}{
+		{"authorization header", "Authorization", "Bearer s3cret-token", true},
+		{"session cookie", "Cookie", "theme=dark; session=s3cret-token", true},
+		{"other cookie", "Cookie", "theme=dark", false},
+		{"anonymous", "", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.WithAuthPresent = true
+				rl.AuthCookies = []string{"session"}
+				rl.WithCookies = true
+			})
+			r := newTestRequest("GET", "/", nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.cookie)
+			}
+			serve(t, rl, r, respond(200, "", "ok"))
+
+			if got := lastEntry(t, mr, "access")["auth_present"]; got != tc.want {
+				t.Errorf("auth_present = %v, want %v", got, tc.want)
+			}
+			// 凭据的值不能出现在日志的任何位置
+			raw, _ := mr.List("access")
+			if strings.Contains(raw[0], "s3cret-token") {
+				t.Errorf("credential leaked into the entry: %s", raw[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package redislogger
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// 请求体、响应体最多记录的字节数
+const (
+	defaultMaxBodySize         = 1 << 20
+	defaultMaxResponseBodySize = 1 << 20
+)
+
+// capturedBody 是在调用下游之前预读的请求体
+type capturedBody struct {
+	data      []byte
+	truncated bool
+	err       error // 读取失败时的错误，此时 data 为出错前读到的部分
+}
+
+// captureRequestBody 在调用下游handler之前预读最多 limit 字节的请求体，
+// 并把 r.Body 替换为"已读部分+剩余部分"的回放reader，下游仍然能读到完整的请求体。
+// 读取出错时返回已读到的部分与错误，下游读到已读部分之后会再次遇到这个错误。
+func captureRequestBody(r *http.Request, limit int64) *capturedBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &capturedBody{}
+	}
+
+	// 多读一个字节用来判断是否被截断
+	buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body = &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(buf), r.Body),
+		closer: r.Body,
+	}
+
+	captured := &capturedBody{data: buf, err: err}
+	if int64(len(buf)) > limit {
+		captured.data = buf[:limit]
+		captured.truncated = true
+	}
+	return captured
+}
+
+// decompress 按 Content-Encoding 解压 gzip/deflate 编码的请求体，解压后最多保留 limit 字节。
+// 请求体已被截断时只解压能解出的部分；不是合法的压缩数据或编码不支持时保留原始字节。
+func (b *capturedBody) decompress(encoding string, limit int64) {
+	if len(b.data) == 0 {
+		return
+	}
+
+	var zr io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(bytes.NewReader(b.data))
+		if err != nil {
+			return
+		}
+		zr = r
+	case "deflate":
+		// HTTP 的 deflate 按规范是zlib格式，但也有客户端直接发送raw deflate
+		if r, err := zlib.NewReader(bytes.NewReader(b.data)); err == nil {
+			zr = r
+		} else {
+			zr = flate.NewReader(bytes.NewReader(b.data))
+		}
+	default:
+		return
+	}
+
+	// 多读一个字节判断解压后是否超过上限，避免压缩炸弹占用内存
+	plain, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil && len(plain) == 0 {
+		return
+	}
+	// 截断的压缩数据在末尾报 unexpected EOF，已解出的部分仍然有效
+	truncated := b.truncated || err != nil
+	if int64(len(plain)) > limit {
+		plain = plain[:limit]
+		truncated = true
+	}
+	b.data = plain
+	b.truncated = truncated
+}
+
+// acquireBodySlot 非阻塞地占用一个body捕获名额，未配置 MaxConcurrentBodyCaptures 时总是成功。
+// 名额已满时返回false，请求不等待。
+func (rl *RedisLogger) acquireBodySlot() (release func(), ok bool) {
+	if rl.bodySlots == nil {
+		return func() {}, true
+	}
+	select {
+	case rl.bodySlots <- struct{}{}:
+		return func() { <-rl.bodySlots }, true
+	default:
+		return nil, false
+	}
+}
+
+// replayBody 先回放预读的数据，再继续读取原始请求体
+type replayBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (b *replayBody) Close() error {
+	return b.closer.Close()
+}
+
+// shouldCaptureResponse 在写响应头时决定是否记录响应体。
+// 声明的 Content-Length 超过 MaxResponseBodySize、SSE 响应，或状态码、Content-Type 不在
+// ResponseBodyStatus、ResponseBodyTypes 中时不记录。
+func (rl *RedisLogger) shouldCaptureResponse(status int, header http.Header) bool {
+	if contentTypeMatches(header.Get("Content-Type"), []string{"text/event-stream"}) {
+		return false
+	}
+	if cl := header.Get("Content-Length"); cl != "" {
+		if size, err := strconv.ParseInt(cl, 10, 64); err == nil && size > rl.MaxResponseBodySize {
+			return false
+		}
+	}
+	if len(rl.respBodyStatus) > 0 && !inStatusRanges(rl.respBodyStatus, statusOrOK(status)) {
+		return false
+	}
+	if len(rl.ResponseBodyTypes) > 0 && !contentTypeMatches(header.Get("Content-Type"), rl.ResponseBodyTypes) {
+		return false
+	}
+	return true
+}
+
+// contentTypeMatches 判断 Content-Type 是否以任一类型开头，不区分大小写
+func contentTypeMatches(contentType string, types []string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if contentType == "" {
+		return false
+	}
+	for _, t := range types {
+		if strings.HasPrefix(contentType, strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCapture 在响应写给客户端的同时复制最多 limit 字节的响应体。
+// 响应不会被缓冲，分块传输、SSE、长轮询等响应照常流式发送，占用的内存不超过 limit。
+type responseCapture struct {
+	*caddyhttp.ResponseWriterWrapper
+	rl        *RedisLogger
+	limit     int64
+	buf       bytes.Buffer
+	decided   bool
+	capturing bool // 写响应头时 shouldCaptureResponse 的结果
+	truncated bool
+}
+
+func (rl *RedisLogger) newResponseCapture(w http.ResponseWriter) *responseCapture {
+	return &responseCapture{
+		ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{ResponseWriter: w},
+		rl:                    rl,
+		limit:                 rl.MaxResponseBodySize,
+	}
+}
+
+// decide 在第一次写入最终响应头时决定是否记录响应体，1xx 响应不算
+func (c *responseCapture) decide(status int) {
+	if c.decided || (status >= 100 && status < 200) {
+		return
+	}
+	c.decided = true
+	c.capturing = c.rl.shouldCaptureResponse(status, c.Header())
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	c.decide(status)
+	c.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(p []byte) (int, error) {
+	c.decide(http.StatusOK)
+	if c.capturing {
+		if room := c.limit - int64(c.buf.Len()); int64(len(p)) > room {
+			c.buf.Write(p[:max(room, 0)])
+			c.truncated = true
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return c.ResponseWriterWrapper.Write(p)
+}
+
+// ReadFrom 不记录响应体时保留底层的零拷贝写入，记录时经过 Write 复制
+func (c *responseCapture) ReadFrom(r io.Reader) (int64, error) {
+	c.decide(http.StatusOK)
+	if !c.capturing {
+		return c.ResponseWriterWrapper.ReadFrom(r)
+	}
+	return io.Copy(writerOnly{c}, r)
+}
+
+// writerOnly 隐藏 ReadFrom，避免 io.Copy 再次调用 responseCapture.ReadFrom
+type writerOnly struct {
+	io.Writer
+}
+
+// body 返回记录下来的响应体；没有记录时 ok 为false
+func (c *responseCapture) body() (data []byte, truncated, ok bool) {
+	if !c.capturing {
+		return nil, false, false
+	}
+	return c.buf.Bytes(), c.truncated, true
+}
+
+// 请求体与响应体的编码方式
+const (
+	bodyEncodingUTF8   = "utf8"   // 原样作为字符串（默认），非法的UTF-8字节在JSON中会变成U+FFFD
+	bodyEncodingBase64 = "base64" // 标准base64
+	bodyEncodingHex    = "hex"    // 小写十六进制
+)
+
+// validateBodyEncoding 检查 BodyEncoding 配置是否合法
+func validateBodyEncoding(encoding string) error {
+	switch encoding {
+	case "", bodyEncodingUTF8, bodyEncodingBase64, bodyEncodingHex:
+		return nil
+	default:
+		return fmt.Errorf("unsupported body_encoding '%s', expected utf8, base64 or hex", encoding)
+	}
+}
+
+// encodeBody 按 BodyEncoding 把请求体或响应体转为字符串
+func (rl *RedisLogger) encodeBody(data []byte) string {
+	switch rl.BodyEncoding {
+	case bodyEncodingBase64:
+		return base64.StdEncoding.EncodeToString(data)
+	case bodyEncodingHex:
+		return hex.EncodeToString(data)
+	default:
+		return string(data)
+	}
+}
@@ -0,0 +1,418 @@
+package redislogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// echoBody 是把请求体原样写回的下游handler
+var echoBody = caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+	_, err := io.Copy(w, r.Body)
+	return err
+})
+
+func TestRequestBodyRestored(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithBody = true
+	})
+
+	w := serve(t, rl, newTestRequest("POST", "/", strings.NewReader(`{"name":"caddy"}`)), echoBody)
+	if w.Body.String() != `{"name":"caddy"}` {
+		t.Errorf("downstream read %q", w.Body.String())
+	}
+	entry := lastEntry(t, mr, "access")
+	if entry["request_body"] != `{"name":"caddy"}` {
+		t.Errorf("request_body = %v", entry["request_body"])
+	}
+}
+
+func TestRequestBodyTruncated(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithBody = true
+		rl.MaxBodySize = 4
+	})
+
+	w := serve(t, rl, newTestRequest("POST", "/", strings.NewReader("0123456789")), echoBody)
+	// 下游仍然读到完整的请求体
+	if w.Body.String() != "0123456789" {
+		t.Errorf("downstream read %q", w.Body.String())
+	}
+	entry := lastEntry(t, mr, "access")
+	if entry["request_body"] != "0123" || entry["request_body_truncated"] != true {
+		t.Errorf("unexpected body fields in %v", entry)
+	}
+}
+
+func TestRequestBodyGzip(t *testing.T) {
+	plain := strings.Repeat(`{"event":"signup","user":"caddy"}`, 20)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, plain)
+	zw.Close()
+	compressed := buf.String()
+	if len(compressed) > 100 {
+		t.Fatalf("compressed body is %d bytes, the limited case needs it to fit in max_body_size", len(compressed))
+	}
+
+	for _, tc := range []struct {
+		name       string
+		limit      int64
+		want       string
+		truncation bool
+	}{
+		{"full", 0, plain, false},
+		// 压缩数据完整读到，解压后的内容同样受 max_body_size 限制
+		{"limited", 100, plain[:100], true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.WithBody = true
+				rl.MaxBodySize = tc.limit
+			})
+			r := newTestRequest("POST", "/", strings.NewReader(compressed))
+			r.Header.Set("Content-Encoding", "gzip")
+			w := serve(t, rl, r, echoBody)
+
+			// 下游收到的仍是压缩后的原始字节
+			if w.Body.String() != compressed {
+				t.Error("downstream did not receive the compressed body unchanged")
+			}
+			entry := lastEntry(t, mr, "access")
+			if entry["request_body"] != tc.want {
+				t.Errorf("request_body = %q, want %q", entry["request_body"], tc.want)
+			}
+			if truncated := entry["request_body_truncated"] == true; truncated != tc.truncation {
+				t.Errorf("request_body_truncated = %v, want %v", truncated, tc.truncation)
+			}
+		})
+	}
+}
+
+func TestBodyCaptureLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithBody = true
+		rl.MaxConcurrentBodyCaptures = 1
+	})
+
+	// 第一个请求占住唯一的名额，直到 release 关闭
+	started, release := make(chan struct{}), make(chan struct{})
+	held := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		close(started)
+		<-release
+		return echoBody(w, r)
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("POST", "/held", strings.NewReader("first")), held)
+	}()
+	<-started
+
+	// 名额用完时照常处理请求，只是不记录body
+	w := serve(t, rl, newTestRequest("POST", "/over", strings.NewReader("second")), echoBody)
+	if w.Body.String() != "second" {
+		t.Errorf("downstream read %q", w.Body.String())
+	}
+	close(release)
+	<-done
+	// 名额释放后恢复捕获
+	serve(t, rl, newTestRequest("POST", "/after", strings.NewReader("third")), echoBody)
+
+	byURI := make(map[any]map[string]any)
+	for _, entry := range entries(t, mr, "access") {
+		byURI[entry["request"].(map[string]any)["uri"]] = entry
+	}
+	if entry := byURI["/over"]; entry == nil || entry["body_skipped"] != true || entry["request_body"] != nil {
+		t.Errorf("expected the body to be skipped past the limit, got %v", entry)
+	}
+	for uri, body := range map[string]string{"/held": "first", "/after": "third"} {
+		if entry := byURI[uri]; entry == nil || entry["request_body"] != body || entry["body_skipped"] != nil {
+			t.Errorf("%s: expected request_body %q, got %v", uri, body, entry)
+		}
+	}
+}
+
+func TestResponseBodyLogged(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithResponseBody = true
+	})
+
+	w := serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "application/json", `{"ok":true}`))
+	if w.Body.String() != `{"ok":true}` {
+		t.Errorf("client received %q", w.Body.String())
+	}
+	entry := lastEntry(t, mr, "access")
+	if entry["response_body"] != `{"ok":true}` {
+		t.Errorf("response_body = %v", entry["response_body"])
+	}
+	if _, ok := entry["response_body_truncated"]; ok {
+		t.Error("response body should not be marked truncated")
+	}
+}
+
+func TestResponseBodyTruncated(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithResponseBody = true
+		rl.MaxResponseBodySize = 5
+	})
+
+	// 分两次写入，第二次越过上限
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		io.WriteString(w, "abc")
+		_, err := io.WriteString(w, "defgh")
+		return err
+	})
+	w := serve(t, rl, newTestRequest("GET", "/", nil), next)
+	if w.Body.String() != "abcdefgh" {
+		t.Errorf("client received %q", w.Body.String())
+	}
+	entry := lastEntry(t, mr, "access")
+	if entry["response_body"] != "abcde" || entry["response_body_truncated"] != true {
+		t.Errorf("unexpected body fields in %v", entry)
+	}
+}
+
+func TestResponseBodyReadFrom(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithResponseBody = true
+	})
+
+	// 文件服务器等handler通过 io.Copy 写响应，会调用 ReadFrom
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		_, err := io.Copy(w, strings.NewReader("copied body"))
+		return err
+	})
+	w := serve(t, rl, newTestRequest("GET", "/", nil), next)
+	if w.Body.String() != "copied body" {
+		t.Errorf("client received %q", w.Body.String())
+	}
+	if entry := lastEntry(t, mr, "access"); entry["response_body"] != "copied body" {
+		t.Errorf("response_body = %v", entry["response_body"])
+	}
+}
+
+func TestResponseBodyStreamed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithResponseBody = true
+	})
+
+	// 记录响应体时响应也不被缓冲，handler返回之前客户端就已经收到写出的数据
+	w := httptest.NewRecorder()
+	next := caddyhttp.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) error {
+		io.WriteString(rw, "chunk")
+		if w.Body.String() != "chunk" {
+			t.Errorf("response was buffered, client has %q", w.Body.String())
+		}
+		return nil
+	})
+	if err := rl.ServeHTTP(w, newTestRequest("GET", "/", nil), next); err != nil {
+		t.Fatal(err)
+	}
+	if entry := lastEntry(t, mr, "access"); entry["response_body"] != "chunk" {
+		t.Errorf("response_body = %v", entry["response_body"])
+	}
+}
+
+func TestBodyEncoding(t *testing.T) {
+	binary := []byte{0xff, 0xfe, 'o', 'k', 0x00, 0x80}
+	for _, tc := range []struct {
+		encoding string
+		want     string
+	}{
+		{bodyEncodingBase64, base64.StdEncoding.EncodeToString(binary)},
+		{bodyEncodingHex, hex.EncodeToString(binary)},
+	} {
+		t.Run(tc.encoding, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.WithBody = true
+				rl.WithResponseBody = true
+				rl.BodyEncoding = tc.encoding
+			})
+			serve(t, rl, newTestRequest("POST", "/", strings.NewReader(string(binary))), echoBody)
+
+			values, _ := mr.List("access")
+			if len(values) != 1 || !json.Valid([]byte(values[0])) {
+				t.Fatalf("expected one valid JSON entry, got %q", values)
+			}
+			entry := lastEntry(t, mr, "access")
+			if entry["request_body"] != tc.want || entry["response_body"] != tc.want {
+				t.Errorf("request_body = %v, response_body = %v, want %s", entry["request_body"], entry["response_body"], tc.want)
+			}
+		})
+	}
+
+	if err := validateBodyEncoding("base32"); err == nil {
+		t.Error("expected an unknown body_encoding to be rejected")
+	}
+}
+
+func TestResponseCaptureSelective(t *testing.T) {
+	image := strings.Repeat("\x89PNG", 1024)
+	for _, tc := range []struct {
+		name     string
+		next     func(client *httptest.ResponseRecorder) caddyhttp.HandlerFunc
+		received string
+		captured any
+	}{
+		{
+			// 声明的 Content-Length 超过上限，不复制响应体
+			name: "large image",
+			next: func(*httptest.ResponseRecorder) caddyhttp.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) error {
+					w.Header().Set("Content-Type", "image/png")
+					w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+					_, err := io.WriteString(w, image)
+					return err
+				}
+			},
+			received: image,
+		},
+		{
+			// SSE从不记录，每个事件在handler返回之前就已经发给客户端
+			name: "server-sent events",
+			next: func(client *httptest.ResponseRecorder) caddyhttp.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) error {
+					w.Header().Set("Content-Type", "text/event-stream")
+					io.WriteString(w, "data: 1\n\n")
+					if client.Body.String() != "data: 1\n\n" {
+						t.Errorf("event stream was buffered, client has %q", client.Body.String())
+					}
+					_, err := io.WriteString(w, "data: 2\n\n")
+					return err
+				}
+			},
+			received: "data: 1\n\ndata: 2\n\n",
+		},
+		{
+			name: "json error",
+			next: func(*httptest.ResponseRecorder) caddyhttp.HandlerFunc {
+				return respond(500, "application/json", `{"error":"boom"}`)
+			},
+			received: `{"error":"boom"}`,
+			captured: `{"error":"boom"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.WithResponseBody = true
+				rl.MaxResponseBodySize = 1024
+			})
+			client := httptest.NewRecorder()
+			if err := rl.ServeHTTP(client, newTestRequest("GET", "/", nil), tc.next(client)); err != nil {
+				t.Fatal(err)
+			}
+			if client.Body.String() != tc.received {
+				t.Errorf("client received %d bytes, want %d", client.Body.Len(), len(tc.received))
+			}
+			if got := lastEntry(t, mr, "access")["response_body"]; got != tc.captured {
+				t.Errorf("response_body = %v, want %v", got, tc.captured)
+			}
+		})
+	}
+}
+
+// failingReader 先返回 data，之后每次读取都返回 err
+type failingReader struct {
+	data string
+	err  error
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if fr.data == "" {
+		return 0, fr.err
+	}
+	n := copy(p, fr.data)
+	fr.data = fr.data[n:]
+	return n, nil
+}
+
+func TestRequestBodyReadError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithBody = true
+	})
+
+	// 下游读到已读部分之后再次遇到同一个错误
+	var downstream string
+	var downstreamErr error
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		data, err := io.ReadAll(r.Body)
+		downstream, downstreamErr = string(data), err
+		w.WriteHeader(http.StatusBadRequest)
+		return nil
+	})
+	body := &failingReader{data: `{"partial":`, err: errors.New("client disconnected")}
+	serve(t, rl, newTestRequest("POST", "/upload", body), next)
+	if downstream != `{"partial":` || downstreamErr == nil || downstreamErr.Error() != "client disconnected" {
+		t.Errorf("downstream read %q, %v", downstream, downstreamErr)
+	}
+
+	// 请求照常记录，带上已读到的部分与错误
+	entry := lastEntry(t, mr, "access")
+	if entry["status"] != float64(http.StatusBadRequest) || entry["request"].(map[string]any)["uri"] != "/upload" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	if entry["request_body"] != `{"partial":` || entry["request_body_error"] != "client disconnected" {
+		t.Errorf("request_body = %q, request_body_error = %q", entry["request_body"], entry["request_body_error"])
+	}
+}
+
+func TestBodyContentTypes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithBody = true
+		rl.BodyContentTypes = []string{"application/json"}
+	})
+
+	var upload bytes.Buffer
+	mw := multipart.NewWriter(&upload)
+	part, _ := mw.CreateFormFile("file", "avatar.png")
+	part.Write([]byte("\x89PNG binary data"))
+	mw.Close()
+
+	for _, tc := range []struct {
+		contentType, body string
+		logged            bool
+	}{
+		{mw.FormDataContentType(), upload.String(), false},
+		{"application/json; charset=utf-8", `{"name":"caddy"}`, true},
+		{"", "no content type", false},
+	} {
+		r := newTestRequest("POST", "/", strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			r.Header.Set("Content-Type", tc.contentType)
+		}
+		// 不记录请求体时下游照常读到完整的请求体
+		if w := serve(t, rl, r, echoBody); w.Body.String() != tc.body {
+			t.Errorf("%q: downstream read %q", tc.contentType, w.Body.String())
+		}
+		body, ok := entries(t, mr, "access")[0]["request_body"]
+		if ok != tc.logged || (tc.logged && body != tc.body) {
+			t.Errorf("%q: request_body = %q, logged = %v, want logged = %v", tc.contentType, body, ok, tc.logged)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package redislogger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// 缓冲写入的默认参数
+const (
+	defaultBatchSize       = 100
+	defaultFlushInterval   = time.Second
+	defaultShutdownTimeout = 5 * time.Second
+)
+
+// logBuffer 是有界的日志缓冲队列，由后台协程批量写入Redis
+type logBuffer struct {
+	items   chan logItem
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	// 关闭超时后取消正在进行的写入，剩余日志按写入失败处理
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// startBuffer 创建缓冲队列并启动后台写入协程
+func (rl *RedisLogger) startBuffer() {
+	if rl.BatchSize <= 0 {
+		rl.BatchSize = defaultBatchSize
+	}
+	if rl.FlushInterval <= 0 {
+		rl.FlushInterval = caddy.Duration(defaultFlushInterval)
+	}
+
+	if rl.ShutdownTimeout <= 0 {
+		rl.ShutdownTimeout = caddy.Duration(defaultShutdownTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rl.buffer = &logBuffer{
+		items:  make(chan logItem, rl.BufferSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go rl.runFlusher()
+}
+
+// enqueue 非阻塞地把日志放入缓冲队列，队列已满或已关闭时返回false
+func (b *logBuffer) enqueue(item logItem) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return false
+	}
+	select {
+	case b.items <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+// runFlusher 从缓冲队列中取出日志，攒够 BatchSize 条或每隔 FlushInterval 写入一次。
+// 队列关闭后把剩余日志全部写入再退出。
+func (rl *RedisLogger) runFlusher() {
+	defer close(rl.buffer.done)
+
+	ticker := time.NewTicker(time.Duration(rl.FlushInterval))
+	defer ticker.Stop()
+
+	batch := make([]logItem, 0, rl.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := rl.pushWithRetry(rl.buffer.ctx, batch); err != nil {
+			rl.logger.Error("Error flushing log entries to Redis",
+				zap.Int("entries", len(batch)),
+				zap.Error(err),
+			)
+			// 异步写入时已经无法让请求失败，fail 策略等同于 ignore
+			_ = rl.handlePushError(batch, err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case item, ok := <-rl.buffer.items:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) >= rl.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// stop 关闭缓冲队列并等待后台协程写完剩余日志。
+// 超过 timeout 仍未写完时取消写入，剩余日志按写入失败处理（落盘或按 OnError 处理），并返回错误。
+func (b *logBuffer) stop(timeout time.Duration) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.items)
+	b.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-b.done:
+		b.cancel()
+		return nil
+	case <-timer.C:
+	}
+
+	pending := len(b.items)
+	b.cancel()
+	<-b.done
+	return fmt.Errorf("timed out after %s flushing buffered log entries, %d still queued", timeout, pending)
+}
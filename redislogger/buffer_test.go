@@ -0,0 +1,137 @@
+package redislogger
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestBufferFlushesFullBatch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.BufferSize = 10
+		rl.BatchSize = 3
+		rl.FlushInterval = caddy.Duration(time.Hour)
+	})
+
+	for i := 0; i < 2; i++ {
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := listLen(mr, "access"); n != 0 {
+		t.Fatalf("expected no entries before the batch is full, got %d", n)
+	}
+
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	waitFor(t, "a full batch", func() bool { return listLen(mr, "access") == 3 })
+}
+
+func TestBufferFlushesOnInterval(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.BufferSize = 10
+		rl.BatchSize = 100
+		rl.FlushInterval = caddy.Duration(10 * time.Millisecond)
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	waitFor(t, "the flush interval", func() bool { return listLen(mr, "access") == 1 })
+}
+
+func TestBufferDrainsOnCleanup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.BufferSize = 10
+		rl.BatchSize = 100
+		rl.FlushInterval = caddy.Duration(time.Hour)
+	})
+	for i := 0; i < 5; i++ {
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}
+	if err := cleanup(rl); err != nil {
+		t.Fatal(err)
+	}
+	if n := listLen(mr, "access"); n != 5 {
+		t.Fatalf("expected 5 entries after Cleanup, got %d", n)
+	}
+}
+
+func TestBufferEnqueue(t *testing.T) {
+	b := &logBuffer{items: make(chan logItem, 1)}
+	if !b.enqueue(logItem{key: "a"}) {
+		t.Fatal("expected the first item to be queued")
+	}
+	if b.enqueue(logItem{key: "b"}) {
+		t.Fatal("expected a full queue to reject the item")
+	}
+	<-b.items
+	b.closed = true
+	if b.enqueue(logItem{key: "c"}) {
+		t.Fatal("expected a closed queue to reject the item")
+	}
+}
+
+func TestBufferFullPolicy(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, nil)
+	// 没有后台协程消费的队列总是满的
+	rl.buffer = &logBuffer{items: make(chan logItem)}
+	defer func() { rl.buffer = nil }()
+
+	if err := rl.send([]logItem{{key: "access", value: []byte(`{}`)}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := listLen(mr, "access"); n != 1 {
+		t.Fatalf("expected a full queue to fall back to a direct write, got %d entries", n)
+	}
+
+	rl.DropOnFull = true
+	if err := rl.send([]logItem{{key: "access", value: []byte(`{}`)}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := listLen(mr, "access"); n != 1 || rl.buffer.dropped.Load() != 1 {
+		t.Fatalf("expected drop_on_full to drop the entry, got %d entries", n)
+	}
+}
+
+// blockingClient 的写入一直阻塞到 ctx 被取消，模拟卡住的Redis
+type blockingClient struct {
+	redisClient
+}
+
+func (blockingClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCleanupTimesOut(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.BufferSize = 10
+		rl.BatchSize = 100
+		rl.FlushInterval = caddy.Duration(time.Hour)
+		rl.ShutdownTimeout = caddy.Duration(20 * time.Millisecond)
+	})
+	client := rl.client.get()
+	rl.client.mu.Lock()
+	rl.client.client = blockingClient{client}
+	rl.client.mu.Unlock()
+
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	start := time.Now()
+	err := cleanup(rl)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a drain timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Cleanup took %s despite the 20ms shutdown_timeout", elapsed)
+	}
+	// 超时后仍然关闭连接
+	if err := client.Ping(context.Background()).Err(); err != redis.ErrClosed {
+		t.Errorf("expected the client to be closed, ping returned %v", err)
+	}
+}
@@ -1,15 +1,22 @@
 package redislogger
 
 import (
+	"encoding/json"
+	"strconv"
+	"time"
+
 	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/dustin/go-humanize"
 )
 
 func init() {
 	caddy.RegisterModule(RedisLogger{})
 	httpcaddyfile.RegisterHandlerDirective("redis_logger", parseCaddyfile)
+	httpcaddyfile.RegisterGlobalOption("redis_logger", parseGlobalOption)
 }
 
 func (RedisLogger) CaddyModule() caddy.ModuleInfo {
@@ -26,17 +33,751 @@ func (rl *RedisLogger) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 			return d.Err("missing Redis key")
 		}
 
-		for d.NextBlock(0) {
-			switch d.Val() {
-			case "with_request_body":
-				rl.WithBody = true
-			case "redis_address":
-				if !d.Args(&rl.RedisAddress) {
-					return d.Err("missing Redis address")
+		if err := rl.unmarshalBlock(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalBlock 解析 redis_logger 指令块中的子指令，全局选项中也使用相同的写法。
+// 指令是在全局选项的基础上解析的：列表与map类的子指令在块中第一次出现时先清空，
+// 覆盖全局的值而不是与之合并；开关类的子指令可以写 off 关闭全局中打开的开关。
+func (rl *RedisLogger) unmarshalBlock(d *caddyfile.Dispenser) error {
+	seen := make(map[string]bool)
+	for d.NextBlock(0) {
+		if !seen[d.Val()] {
+			seen[d.Val()] = true
+			rl.resetList(d.Val())
+		}
+		switch d.Val() {
+		case "with_request_body":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithBody = on
+		case "max_body_size":
+			size, err := parseSizeArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxBodySize = size
+		case "with_response_body":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithResponseBody = on
+		case "max_response_body_size":
+			size, err := parseSizeArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxResponseBodySize = size
+		case "redis_address":
+			if !d.Args(&rl.RedisAddress) {
+				return d.Err("missing Redis address")
+			}
+		case "redis_url":
+			if !d.Args(&rl.RedisURL) {
+				return d.Err("missing Redis URL")
+			}
+		case "redis_username":
+			if !d.Args(&rl.RedisUsername) {
+				return d.Err("missing Redis username")
+			}
+		case "redis_password":
+			if !d.Args(&rl.RedisPassword) {
+				return d.Err("missing Redis password")
+			}
+		case "redis_password_file":
+			if !d.Args(&rl.RedisPasswordFile) {
+				return d.Err("missing Redis password file")
+			}
+		case "cluster_addrs":
+			addrs := d.RemainingArgs()
+			if len(addrs) == 0 {
+				return d.Err("missing Redis cluster addresses")
+			}
+			rl.ClusterAddrs = append(rl.ClusterAddrs, addrs...)
+		case "max_len":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxLen = n
+		case "key_ttl":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.KeyTTL = dur
+		case "redis_db":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.RedisDB = &n
+		case "redis_databases":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.RedisDatabases = n
+		case "dial_timeout":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.DialTimeout = time.Duration(dur)
+		case "read_timeout":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.ReadTimeout = time.Duration(dur)
+		case "write_timeout":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WriteTimeout = time.Duration(dur)
+		case "max_retries":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxRetries = n
+		case "pool_size":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.PoolSize = n
+		case "min_idle_conns":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MinIdleConns = n
+		case "pool_timeout":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.PoolTimeout = dur
+		case "idle_timeout":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.IdleTimeout = dur
+		case "max_conn_age":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxConnAge = dur
+		case "idle_check_frequency":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.IdleCheckFrequency = dur
+		case "buffer_size":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.BufferSize = n
+		case "batch_size":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.BatchSize = n
+		case "flush_interval":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.FlushInterval = dur
+		case "drop_on_full":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.DropOnFull = on
+		case "header_include":
+			names := d.RemainingArgs()
+			if len(names) == 0 {
+				return d.Err("missing header names")
+			}
+			rl.HeaderInclude = append(rl.HeaderInclude, names...)
+		case "header_exclude":
+			names := d.RemainingArgs()
+			if len(names) == 0 {
+				return d.Err("missing header names")
+			}
+			rl.HeaderExclude = append(rl.HeaderExclude, names...)
+		case "redact":
+			names := d.RemainingArgs()
+			if len(names) == 0 {
+				return d.Err("missing names to redact")
+			}
+			rl.Redact = append(rl.Redact, names...)
+		case "log_status":
+			codes := d.RemainingArgs()
+			if len(codes) == 0 {
+				return d.Err("missing status codes")
+			}
+			rl.LogStatus = append(rl.LogStatus, codes...)
+		case "skip_paths":
+			paths := d.RemainingArgs()
+			if len(paths) == 0 {
+				return d.Err("missing paths to skip")
+			}
+			rl.SkipPaths = append(rl.SkipPaths, paths...)
+		case "skip_methods":
+			methods := d.RemainingArgs()
+			if len(methods) == 0 {
+				return d.Err("missing methods to skip")
+			}
+			rl.SkipMethods = append(rl.SkipMethods, methods...)
+		case "sample_rate":
+			var val string
+			if !d.Args(&val) {
+				return d.Err("missing sample rate")
+			}
+			rate, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return d.Errf("invalid sample rate: %s", val)
+			}
+			rl.SampleRate = rate
+		case "sample_keep_errors":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.SampleKeepErrors = on
+		case "fields":
+			fields := d.RemainingArgs()
+			if len(fields) == 0 {
+				return d.Err("missing field names")
+			}
+			rl.Fields = append(rl.Fields, fields...)
+		case "time_format":
+			if !d.Args(&rl.TimeFormat) {
+				return d.Err("missing time format")
+			}
+		case "format":
+			if !d.Args(&rl.Format) {
+				return d.Err("missing format")
+			}
+		case "compress":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.Compress = on
+		case "compress_threshold":
+			size, err := parseSizeArg(d)
+			if err != nil {
+				return err
+			}
+			rl.CompressThreshold = int(size)
+		case "on_error":
+			if !d.Args(&rl.OnError) {
+				return d.Err("missing on_error policy")
+			}
+		case "spill_dir":
+			if !d.Args(&rl.SpillDir) {
+				return d.Err("missing spill directory")
+			}
+		case "spill_max_bytes":
+			size, err := parseSizeArg(d)
+			if err != nil {
+				return err
+			}
+			rl.SpillMaxBytes = size
+		case "spill_retry_interval":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.SpillRetryInterval = dur
+		case "health_check_interval":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.HealthCheckInterval = dur
+		case "health_check_failures":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.HealthCheckFailures = n
+		case "redis_key":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			rl.RedisKeys = append(rl.RedisKeys, args...)
+		case "capture_vars":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			rl.CaptureVars = append(rl.CaptureVars, args...)
+		case "request_id_header":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.RequestIDHeader = d.Val()
+		case "request_id_response":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.RequestIDResponse = on
+		case "duration_unit":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.DurationUnit = d.Val()
+		case "client_ip_strategy":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.ClientIPStrategy = d.Val()
+		case "trusted_proxies":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			rl.TrustedProxies = append(rl.TrustedProxies, args...)
+		case "slow_threshold":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.SlowThreshold = dur
+		case "transactional":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.Transactional = on
+		case "field_map":
+			for nesting := d.Nesting(); d.NextBlock(nesting); {
+				from := d.Val()
+				var to string
+				if !d.Args(&to) {
+					return d.Errf("missing new name for field %s", from)
+				}
+				if rl.FieldMap == nil {
+					rl.FieldMap = make(map[string]string)
+				}
+				rl.FieldMap[from] = to
+			}
+		case "output_schema":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.OutputSchema = d.Val()
+		case "skip_hosts":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			rl.SkipHosts = append(rl.SkipHosts, args...)
+		case "only_hosts":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			rl.OnlyHosts = append(rl.OnlyHosts, args...)
+		case "fallback_address":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.FallbackAddress = d.Val()
+		case "fallback_username":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.FallbackUsername = d.Val()
+		case "fallback_password":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.FallbackPassword = d.Val()
+		case "failback_interval":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.FailbackInterval = dur
+		case "log_name":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.LogName = d.Val()
+		case "max_entry_bytes":
+			size, err := parseSizeArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxEntryBytes = int(size)
+		case "oversize_policy":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.OversizePolicy = d.Val()
+		case "unique_ip_key":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.UniqueIPKey = d.Val()
+		case "stats_key_prefix":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.StatsKeyPrefix = d.Val()
+		case "stats_ttl":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.StatsTTL = dur
+		case "output_mode":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.OutputMode = d.Val()
+		case "compression_algo":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.CompressionAlgo = d.Val()
+		case "shutdown_timeout":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.ShutdownTimeout = dur
+		case "redis_network":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.RedisNetwork = d.Val()
+		case "geo_headers":
+			for nesting := d.Nesting(); d.NextBlock(nesting); {
+				header := d.Val()
+				var field string
+				if !d.Args(&field) {
+					return d.Errf("missing field name for geo header %s", header)
 				}
-			case "redis_password":
-				if !d.Args(&rl.RedisPassword) {
-					return d.Err("missing Redis password")
+				if rl.GeoHeaders == nil {
+					rl.GeoHeaders = make(map[string]string)
+				}
+				rl.GeoHeaders[header] = field
+			}
+		case "shard_by_method":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.ShardByMethod = on
+		case "startup_retries":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.StartupRetries = n
+		case "startup_retry_interval":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.StartupRetryInterval = dur
+		case "soft_start":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.SoftStart = on
+		case "with_bytes_written":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithBytesWritten = on
+		case "check_content_length":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.CheckContentLength = on
+		case "body_encoding":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.BodyEncoding = d.Val()
+		case "max_in_flight":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxInFlight = n
+		case "full_policy":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.FullPolicy = d.Val()
+		case "in_flight_wait":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.InFlightWait = dur
+		case "max_pushes_per_second":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := strconv.ParseFloat(d.Val(), 64)
+			if err != nil {
+				return d.Errf("invalid max_pushes_per_second: %s", d.Val())
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.MaxPushesPerSecond = n
+		case "log_errors":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.LogErrors = on
+		case "with_request_line":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithRequestLine = on
+		case "with_request_uuid":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithRequestUUID = on
+		case "with_auth_present":
+			args := d.RemainingArgs()
+			if len(args) == 1 && isOffArg(args[0]) {
+				rl.WithAuthPresent = false
+				break
+			}
+			rl.WithAuthPresent = true
+			rl.AuthCookies = append(rl.AuthCookies, args...)
+		case "dedupe":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.Dedupe = on
+		case "dedupe_window":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.DedupeWindow = dur
+		case "dedupe_fields":
+			fields := d.RemainingArgs()
+			if len(fields) == 0 {
+				return d.ArgErr()
+			}
+			rl.DedupeFields = append(rl.DedupeFields, fields...)
+		case "with_received_at":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithReceivedAt = on
+		case "sanitize_control_chars":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.SanitizeControlChars = on
+		case "max_concurrent_body_captures":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxConcurrentBodyCaptures = n
+		case "transformer":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			name := d.Val()
+			unm, err := caddyfile.UnmarshalModule(d, transformerNamespace+"."+name)
+			if err != nil {
+				return err
+			}
+			rl.TransformersRaw = append(rl.TransformersRaw, caddyconfig.JSONModuleObject(unm, transformerKey, name, nil))
+		case "push_retries":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.PushRetries = n
+		case "push_retry_backoff":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.PushRetryBackoff = dur
+		case "key_prefix":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.KeyPrefix = d.Val()
+		case "with_query":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithQuery = on
+		case "with_cookies":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.WithCookies = on
+		case "max_headers":
+			n, err := parseIntArg(d)
+			if err != nil {
+				return err
+			}
+			rl.MaxHeaders = n
+		case "use_script":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.UseScript = on
+		case "client_name":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.ClientName = d.Val()
+		case "response_body_status":
+			codes := d.RemainingArgs()
+			if len(codes) == 0 {
+				return d.ArgErr()
+			}
+			rl.ResponseBodyStatus = append(rl.ResponseBodyStatus, codes...)
+		case "response_body_types":
+			types := d.RemainingArgs()
+			if len(types) == 0 {
+				return d.ArgErr()
+			}
+			rl.ResponseBodyTypes = append(rl.ResponseBodyTypes, types...)
+		case "fingerprint":
+			attrs := d.RemainingArgs()
+			if len(attrs) == 0 {
+				return d.ArgErr()
+			}
+			rl.Fingerprint = append(rl.Fingerprint, attrs...)
+		case "stream_fields":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.StreamFields = on
+		case "body_content_types":
+			types := d.RemainingArgs()
+			if len(types) == 0 {
+				return d.ArgErr()
+			}
+			rl.BodyContentTypes = append(rl.BodyContentTypes, types...)
+		case "reliable_queue":
+			on, err := parseFlagArg(d)
+			if err != nil {
+				return err
+			}
+			rl.ReliableQueue = on
+		case "processing_key":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.ProcessingKey = d.Val()
+		case "trim_interval":
+			dur, err := parseDurationArg(d)
+			if err != nil {
+				return err
+			}
+			rl.TrimInterval = dur
+		case "envelope":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			rl.EnvelopeType = d.Val()
+			if d.NextArg() {
+				version, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid envelope version: %s", d.Val())
+				}
+				rl.EnvelopeVersion = version
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		case "metadata":
+			var key, value string
+			if !d.Args(&key, &value) {
+				return d.ArgErr()
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			if rl.Metadata == nil {
+				rl.Metadata = make(map[string]string)
+			}
+			rl.Metadata[key] = value
+		case "tls":
+			if d.NextArg() {
+				if !isOffArg(d.Val()) || d.NextArg() {
+					return d.ArgErr()
+				}
+				rl.TLS = false
+				break
+			}
+			rl.TLS = true
+			for nesting := d.Nesting(); d.NextBlock(nesting); {
+				switch d.Val() {
+				case "ca_cert":
+					if !d.Args(&rl.TLSCACert) {
+						return d.Err("missing TLS CA certificate")
+					}
+				case "client_cert":
+					if !d.Args(&rl.TLSClientCert) {
+						return d.Err("missing TLS client certificate")
+					}
+				case "client_key":
+					if !d.Args(&rl.TLSClientKey) {
+						return d.Err("missing TLS client key")
+					}
+				case "insecure_skip_verify":
+					on, err := parseFlagArg(d)
+					if err != nil {
+						return err
+					}
+					rl.TLSInsecureSkipVerify = on
+				default:
+					return d.Errf("unrecognized tls option '%s'", d.Val())
 				}
 			}
 		}
@@ -44,13 +785,173 @@ func (rl *RedisLogger) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	return nil
 }
 
+// resetList 清空列表与map类子指令对应的配置，见 unmarshalBlock。
+// tls 块的子选项也一并清空，指令中的 tls 块完整地描述TLS配置，不会沿用全局的证书与私钥。
+func (rl *RedisLogger) resetList(name string) {
+	switch name {
+	case "tls":
+		rl.TLSCACert, rl.TLSClientCert, rl.TLSClientKey = "", "", ""
+		rl.TLSInsecureSkipVerify = false
+	case "cluster_addrs":
+		rl.ClusterAddrs = nil
+	case "header_include":
+		rl.HeaderInclude = nil
+	case "header_exclude":
+		rl.HeaderExclude = nil
+	case "redact":
+		rl.Redact = nil
+	case "log_status":
+		rl.LogStatus = nil
+	case "skip_paths":
+		rl.SkipPaths = nil
+	case "skip_methods":
+		rl.SkipMethods = nil
+	case "fields":
+		rl.Fields = nil
+	case "redis_key":
+		rl.RedisKeys = nil
+	case "capture_vars":
+		rl.CaptureVars = nil
+	case "trusted_proxies":
+		rl.TrustedProxies = nil
+	case "field_map":
+		rl.FieldMap = nil
+	case "skip_hosts":
+		rl.SkipHosts = nil
+	case "only_hosts":
+		rl.OnlyHosts = nil
+	case "geo_headers":
+		rl.GeoHeaders = nil
+	case "with_auth_present":
+		rl.AuthCookies = nil
+	case "dedupe_fields":
+		rl.DedupeFields = nil
+	case "transformer":
+		rl.TransformersRaw = nil
+	case "response_body_status":
+		rl.ResponseBodyStatus = nil
+	case "response_body_types":
+		rl.ResponseBodyTypes = nil
+	case "fingerprint":
+		rl.Fingerprint = nil
+	case "body_content_types":
+		rl.BodyContentTypes = nil
+	case "metadata":
+		rl.Metadata = nil
+	}
+}
+
+// parseFlagArg 读取开关类子指令的可选参数：不写或写 on/true 时打开，写 off/false 时关闭
+func parseFlagArg(d *caddyfile.Dispenser) (bool, error) {
+	name := d.Val()
+	if !d.NextArg() {
+		return true, nil
+	}
+	val := d.Val()
+	if d.NextArg() {
+		return false, d.ArgErr()
+	}
+	switch {
+	case val == "on" || val == "true":
+		return true, nil
+	case isOffArg(val):
+		return false, nil
+	default:
+		return false, d.Errf("invalid value for %s: %s, expected on or off", name, val)
+	}
+}
+
+// isOffArg 判断参数是否表示关闭
+func isOffArg(val string) bool {
+	return val == "off" || val == "false"
+}
+
+// parseIntArg 读取当前子指令的唯一整数参数
+func parseIntArg(d *caddyfile.Dispenser) (int, error) {
+	name := d.Val()
+	var val string
+	if !d.Args(&val) {
+		return 0, d.Errf("missing value for %s", name)
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, d.Errf("invalid integer for %s: %s", name, val)
+	}
+	return n, nil
+}
+
+// parseDurationArg 读取当前子指令的唯一时长参数
+func parseDurationArg(d *caddyfile.Dispenser) (caddy.Duration, error) {
+	name := d.Val()
+	var val string
+	if !d.Args(&val) {
+		return 0, d.Errf("missing value for %s", name)
+	}
+	dur, err := caddy.ParseDuration(val)
+	if err != nil {
+		return 0, d.Errf("invalid duration for %s: %s", name, val)
+	}
+	return caddy.Duration(dur), nil
+}
+
+// parseSizeArg 读取当前子指令的唯一字节数参数，支持 64KiB、1MB 等写法
+func parseSizeArg(d *caddyfile.Dispenser) (int64, error) {
+	name := d.Val()
+	var val string
+	if !d.Args(&val) {
+		return 0, d.Errf("missing value for %s", name)
+	}
+	size, err := humanize.ParseBytes(val)
+	if err != nil {
+		return 0, d.Errf("invalid size for %s: %s", name, val)
+	}
+	return int64(size), nil
+}
+
 // parseCaddyfile从h中解读令牌到一个新的中间件。
+// 全局选项中的 redis_logger 作为默认值，指令中写了的子指令覆盖它。
 func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
 	var rl RedisLogger
+	if defaults, ok := h.Option("redis_logger").(*RedisLogger); ok {
+		// 经过JSON深拷贝，各个实例不共享切片和map
+		buf, err := json.Marshal(defaults)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(buf, &rl); err != nil {
+			return nil, err
+		}
+	}
 	err := rl.UnmarshalCaddyfile(h.Dispenser)
 	return &rl, err
 }
 
+// parseGlobalOption 解析全局选项：
+//
+//	{
+//		redis_logger {
+//			redis_address localhost:6379
+//			redis_password secret
+//		}
+//	}
+//
+// 块中的写法与 redis_logger 指令相同，只是没有key参数。
+func parseGlobalOption(d *caddyfile.Dispenser, existing interface{}) (interface{}, error) {
+	defaults, ok := existing.(*RedisLogger)
+	if !ok {
+		defaults = new(RedisLogger)
+	}
+	for d.Next() {
+		if d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		if err := defaults.unmarshalBlock(d); err != nil {
+			return nil, err
+		}
+	}
+	return defaults, nil
+}
+
 // Interface guards
 var (
 	_ caddy.Provisioner           = (*RedisLogger)(nil)
@@ -0,0 +1,223 @@
+package redislogger
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// parseTestCaddyfile 解析 redis_logger 指令
+func parseTestCaddyfile(t *testing.T, input string) *RedisLogger {
+	t.Helper()
+	rl := new(RedisLogger)
+	if err := rl.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err != nil {
+		t.Fatalf("UnmarshalCaddyfile: %v", err)
+	}
+	return rl
+}
+
+func TestCaddyfileClusterAddrs(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		cluster_addrs 10.0.0.1:6379 10.0.0.2:6379
+		cluster_addrs 10.0.0.3:6379
+	}`)
+	want := []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.3:6379"}
+	if !reflect.DeepEqual(rl.ClusterAddrs, want) {
+		t.Errorf("cluster_addrs = %v, want %v", rl.ClusterAddrs, want)
+	}
+}
+
+func TestCaddyfileTLS(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		tls {
+			ca_cert /etc/redis/ca.pem
+			client_cert /etc/redis/client.pem
+			client_key /etc/redis/client.key
+			insecure_skip_verify
+		}
+	}`)
+	if !rl.TLS || rl.TLSCACert != "/etc/redis/ca.pem" || rl.TLSClientCert != "/etc/redis/client.pem" ||
+		rl.TLSClientKey != "/etc/redis/client.key" || !rl.TLSInsecureSkipVerify {
+		t.Errorf("unexpected TLS config %+v", rl)
+	}
+}
+
+func TestCaddyfileTrailingArgs(t *testing.T) {
+	// insecure_skip_verify 与其他开关一样接受 on/off
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		tls {
+			insecure_skip_verify off
+		}
+		max_pushes_per_second 50
+	}`)
+	if !rl.TLS || rl.TLSInsecureSkipVerify || rl.MaxPushesPerSecond != 50 {
+		t.Errorf("unexpected config %+v", rl)
+	}
+
+	for _, bad := range []string{
+		"max_pushes_per_second 50 100",
+		"tls {\ninsecure_skip_verify on extra\n}",
+		"tls {\ninsecure_skip_verify maybe\n}",
+	} {
+		err := new(RedisLogger).UnmarshalCaddyfile(caddyfile.NewTestDispenser("redis_logger access {\n" + bad + "\n}"))
+		if err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestCaddyfilePoolOptions(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		pool_size 20
+		min_idle_conns 4
+		pool_timeout 2s
+		idle_timeout 1m
+		max_conn_age 1h
+		idle_check_frequency 30s
+	}`)
+	if rl.PoolSize != 20 || rl.MinIdleConns != 4 || rl.PoolTimeout != caddy.Duration(2*time.Second) ||
+		rl.IdleTimeout != caddy.Duration(time.Minute) || rl.MaxConnAge != caddy.Duration(time.Hour) ||
+		rl.IdleCheckFrequency != caddy.Duration(30*time.Second) {
+		t.Errorf("unexpected pool config %+v", rl)
+	}
+}
+
+func TestCaddyfileTimeouts(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		dial_timeout 2s
+		read_timeout 500ms
+		write_timeout 750ms
+		max_retries 5
+	}`)
+	if rl.DialTimeout != 2*time.Second || rl.ReadTimeout != 500*time.Millisecond ||
+		rl.WriteTimeout != 750*time.Millisecond || rl.MaxRetries != 5 {
+		t.Errorf("unexpected timeouts %+v", rl)
+	}
+
+	for _, bad := range []string{"dial_timeout soon", "max_retries many", "read_timeout"} {
+		err := new(RedisLogger).UnmarshalCaddyfile(caddyfile.NewTestDispenser("redis_logger access {\n" + bad + "\n}"))
+		if err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestNegativeTimeoutsRejected(t *testing.T) {
+	for name, configure := range map[string]func(*RedisLogger){
+		"dial_timeout":  func(rl *RedisLogger) { rl.DialTimeout = -time.Second },
+		"read_timeout":  func(rl *RedisLogger) { rl.ReadTimeout = -time.Second },
+		"write_timeout": func(rl *RedisLogger) { rl.WriteTimeout = -time.Second },
+		"max_retries":   func(rl *RedisLogger) { rl.MaxRetries = -1 },
+	} {
+		rl := &RedisLogger{RedisKey: "access", RedisAddress: "127.0.0.1:1"}
+		configure(rl)
+		if err := provision(t, rl); err == nil {
+			t.Errorf("expected a negative %s to be rejected", name)
+		}
+	}
+}
+
+// adaptedLoggers 把完整的Caddyfile转换为JSON，按出现的顺序返回其中的 redis_logger handler
+func adaptedLoggers(t *testing.T, input string) []*RedisLogger {
+	t.Helper()
+	adapter := caddyconfig.GetAdapter("caddyfile")
+	out, warnings, err := adapter.Adapt([]byte(input), nil)
+	if err != nil {
+		t.Fatalf("adapting Caddyfile: %v", err)
+	}
+	for _, w := range warnings {
+		t.Logf("warning: %s", w)
+	}
+	var config any
+	if err := json.Unmarshal(out, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	var loggers []*RedisLogger
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if v["handler"] == "redis_logger" {
+				buf, _ := json.Marshal(v)
+				rl := new(RedisLogger)
+				if err := json.Unmarshal(buf, rl); err != nil {
+					t.Fatal(err)
+				}
+				loggers = append(loggers, rl)
+				return
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(config)
+	return loggers
+}
+
+func TestCaddyfileGlobalDefaults(t *testing.T) {
+	loggers := adaptedLoggers(t, `{
+		redis_logger {
+			redis_address 10.0.0.1:6379
+			trusted_proxies 10.0.0.0/8 172.16.0.0/12
+			with_query
+			tls {
+				ca_cert /etc/redis/ca.pem
+				client_cert /etc/redis/client.pem
+				client_key /etc/redis/client.key
+			}
+		}
+	}
+
+	:8080 {
+		route {
+			redis_logger logs:default
+			redis_logger logs:override {
+				redis_address 10.0.0.2:6379
+				trusted_proxies 192.168.0.0/16
+				with_query off
+				tls {
+					ca_cert /etc/redis/other-ca.pem
+				}
+			}
+		}
+	}`)
+	if len(loggers) != 2 {
+		t.Fatalf("got %d redis_logger handlers, want 2", len(loggers))
+	}
+
+	// 没有写子指令的指令完整继承全局配置
+	inherited := loggers[0]
+	if inherited.RedisKey != "logs:default" || inherited.RedisAddress != "10.0.0.1:6379" || !inherited.WithQuery {
+		t.Errorf("global defaults not inherited: %+v", inherited)
+	}
+	if want := []string{"10.0.0.0/8", "172.16.0.0/12"}; !reflect.DeepEqual(inherited.TrustedProxies, want) {
+		t.Errorf("inherited trusted_proxies = %v, want %v", inherited.TrustedProxies, want)
+	}
+	if !inherited.TLS || inherited.TLSCACert != "/etc/redis/ca.pem" || inherited.TLSClientCert != "/etc/redis/client.pem" ||
+		inherited.TLSClientKey != "/etc/redis/client.key" {
+		t.Errorf("global TLS settings not inherited: %+v", inherited)
+	}
+
+	// 写了的子指令覆盖全局配置：列表被替换而不是追加，off 关闭开关，tls 块不沿用全局的证书
+	override := loggers[1]
+	if override.RedisKey != "logs:override" || override.RedisAddress != "10.0.0.2:6379" || override.WithQuery {
+		t.Errorf("directive did not override the global defaults: %+v", override)
+	}
+	if want := []string{"192.168.0.0/16"}; !reflect.DeepEqual(override.TrustedProxies, want) {
+		t.Errorf("overridden trusted_proxies = %v, want %v", override.TrustedProxies, want)
+	}
+	if !override.TLS || override.TLSCACert != "/etc/redis/other-ca.pem" || override.TLSClientCert != "" || override.TLSClientKey != "" {
+		t.Errorf("tls block should replace the global TLS settings: %+v", override)
+	}
+}
@@ -0,0 +1,307 @@
+package redislogger
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Redis 默认的 databases 数量
+const defaultRedisDatabases = 16
+
+// redisClient 是单机客户端与集群客户端的公共接口，
+// ServeHTTP 等调用方无需关心具体的客户端类型。
+type redisClient interface {
+	redis.Cmdable
+	Close() error
+}
+
+// newClient 根据配置创建单机或集群客户端
+func (rl *RedisLogger) newClient() (redisClient, error) {
+	if len(rl.ClusterAddrs) > 0 {
+		opts, err := rl.clusterOptions()
+		if err != nil {
+			return nil, err
+		}
+		return redis.NewClusterClient(opts), nil
+	}
+	opts, err := rl.redisOptions()
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opts), nil
+}
+
+// db 返回配置的DB，未设置时为默认的0
+func (rl *RedisLogger) db() int {
+	if rl.RedisDB == nil {
+		return 0
+	}
+	return *rl.RedisDB
+}
+
+// networkAddress 返回连接使用的网络与地址：unix:///path/to/redis.sock 形式的
+// redis_address 或 redis_network unix 使用Unix域套接字，其余为TCP
+func (rl *RedisLogger) networkAddress() (network, addr string) {
+	if path, ok := strings.CutPrefix(rl.RedisAddress, "unix://"); ok {
+		return "unix", path
+	}
+	if rl.RedisNetwork != "" {
+		return rl.RedisNetwork, rl.RedisAddress
+	}
+	return "tcp", rl.RedisAddress
+}
+
+// validateNetwork 检查 redis_network，使用Unix域套接字时确认套接字文件存在
+func (rl *RedisLogger) validateNetwork() error {
+	switch rl.RedisNetwork {
+	case "", "tcp", "unix":
+	default:
+		return fmt.Errorf("unsupported redis_network '%s', expected tcp or unix", rl.RedisNetwork)
+	}
+	if len(rl.ClusterAddrs) > 0 || rl.RedisURL != "" {
+		return nil
+	}
+	network, addr := rl.networkAddress()
+	if network != "unix" {
+		return nil
+	}
+	info, err := os.Stat(addr)
+	if err != nil {
+		return fmt.Errorf("redis socket: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("redis socket: %s is not a Unix socket", addr)
+	}
+	return nil
+}
+
+// resolveCredentials 确定最终使用的认证信息：redis_url 与 fallback_password 中的 {env.*} 等全局占位符
+// 在这里展开；配置了 redis_password_file 时读取文件并去掉首尾空白，否则同样展开 redis_password。
+// 只替换已知的占位符，密码中恰好出现的花括号保持原样。
+func (rl *RedisLogger) resolveCredentials() error {
+	repl := caddy.NewReplacer()
+	rl.RedisURL = repl.ReplaceKnown(rl.RedisURL, "")
+	rl.FallbackPassword = repl.ReplaceKnown(rl.FallbackPassword, "")
+	if rl.RedisPasswordFile != "" {
+		data, err := os.ReadFile(rl.RedisPasswordFile)
+		if err != nil {
+			return fmt.Errorf("reading redis_password_file: %w", err)
+		}
+		rl.RedisPassword = strings.TrimSpace(string(data))
+		return nil
+	}
+	rl.RedisPassword = repl.ReplaceKnown(rl.RedisPassword, "")
+	return nil
+}
+
+// defaultClientName 生成默认的连接名 caddy:<主机名>。
+// 连接名是 clientPool 的key的一部分，不能包含 redis_key 等与连接无关的配置，否则写入不同key的实例无法共享客户端。
+// CLIENT SETNAME 不允许空白字符，替换为下划线
+func defaultClientName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, "caddy:"+host)
+}
+
+// onConnect 返回在每个新连接上执行 CLIENT SETNAME 的回调，便于在 CLIENT LIST 中识别本插件的连接。
+// 共享的客户端可能比创建它的实例活得更久，回调只捕获连接名并写包级的日志，不引用任何实例。
+// ACL不允许 CLIENT 命令或托管Redis屏蔽了它时只记录警告，连接照常使用，返回错误会让连接失败。
+func onConnect(clientName string) func(context.Context, *redis.Conn) error {
+	if clientName == "" {
+		return nil
+	}
+	return func(ctx context.Context, cn *redis.Conn) error {
+		if err := cn.ClientSetName(ctx, clientName).Err(); err != nil {
+			caddy.Log().Named("http.handlers.redis_logger").Warn("Error setting the Redis connection name, set client_name to - to skip it",
+				zap.String("client_name", clientName),
+				zap.Error(err),
+			)
+		}
+		return nil
+	}
+}
+
+// displayAddress 返回用于日志的Redis地址，redis_url 只取主机部分，避免打印密码
+func (rl *RedisLogger) displayAddress() string {
+	if len(rl.ClusterAddrs) > 0 {
+		return strings.Join(rl.ClusterAddrs, ",")
+	}
+	if rl.RedisURL != "" {
+		if u, err := url.Parse(rl.RedisURL); err == nil {
+			return u.Host
+		}
+		return ""
+	}
+	return rl.RedisAddress
+}
+
+// redisOptions 构造单机模式的连接参数
+func (rl *RedisLogger) redisOptions() (*redis.Options, error) {
+	tlsConfig, err := rl.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if rl.RedisURL != "" {
+		return rl.urlOptions(tlsConfig)
+	}
+	network, addr := rl.networkAddress()
+	return &redis.Options{
+		Network:            network,
+		Addr:               addr,
+		Username:           rl.RedisUsername,
+		Password:           rl.RedisPassword,
+		DB:                 rl.db(),
+		DialTimeout:        rl.DialTimeout,
+		ReadTimeout:        rl.ReadTimeout,
+		WriteTimeout:       rl.WriteTimeout,
+		MaxRetries:         rl.MaxRetries,
+		PoolSize:           rl.PoolSize,
+		MinIdleConns:       rl.MinIdleConns,
+		PoolTimeout:        time.Duration(rl.PoolTimeout),
+		IdleTimeout:        time.Duration(rl.IdleTimeout),
+		MaxConnAge:         time.Duration(rl.MaxConnAge),
+		IdleCheckFrequency: time.Duration(rl.IdleCheckFrequency),
+		TLSConfig:          tlsConfig,
+		OnConnect:          onConnect(rl.ClientName),
+	}, nil
+}
+
+// urlOptions 解析 redis_url，URL中的地址、认证信息与DB优先于单独配置的字段，
+// URL未指定的超时与重试参数沿用单独配置的值
+func (rl *RedisLogger) urlOptions(tlsConfig *tls.Config) (*redis.Options, error) {
+	opts, err := redis.ParseURL(rl.RedisURL)
+	if err != nil {
+		// url.Error 会带上完整的URL，避免把密码打印到日志里
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid redis_url: %w", err)
+	}
+
+	if opts.Username == "" {
+		opts.Username = rl.RedisUsername
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = rl.DialTimeout
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = rl.ReadTimeout
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = rl.WriteTimeout
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = rl.MaxRetries
+	}
+	if opts.PoolSize == 0 {
+		opts.PoolSize = rl.PoolSize
+	}
+	if opts.MinIdleConns == 0 {
+		opts.MinIdleConns = rl.MinIdleConns
+	}
+	if opts.PoolTimeout == 0 {
+		opts.PoolTimeout = time.Duration(rl.PoolTimeout)
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = time.Duration(rl.IdleTimeout)
+	}
+	if opts.MaxConnAge == 0 {
+		opts.MaxConnAge = time.Duration(rl.MaxConnAge)
+	}
+	if opts.IdleCheckFrequency == 0 {
+		opts.IdleCheckFrequency = time.Duration(rl.IdleCheckFrequency)
+	}
+
+	opts.OnConnect = onConnect(rl.ClientName)
+
+	// rediss:// 已经带了默认的TLS配置，显式配置的tls块优先
+	if tlsConfig != nil {
+		if opts.TLSConfig != nil && tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = opts.TLSConfig.ServerName
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	return opts, nil
+}
+
+// clusterOptions 构造集群模式的连接参数，集群不支持选择DB
+func (rl *RedisLogger) clusterOptions() (*redis.ClusterOptions, error) {
+	tlsConfig, err := rl.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &redis.ClusterOptions{
+		Addrs:              rl.ClusterAddrs,
+		Username:           rl.RedisUsername,
+		Password:           rl.RedisPassword,
+		DialTimeout:        rl.DialTimeout,
+		ReadTimeout:        rl.ReadTimeout,
+		WriteTimeout:       rl.WriteTimeout,
+		MaxRetries:         rl.MaxRetries,
+		PoolSize:           rl.PoolSize,
+		MinIdleConns:       rl.MinIdleConns,
+		PoolTimeout:        time.Duration(rl.PoolTimeout),
+		IdleTimeout:        time.Duration(rl.IdleTimeout),
+		MaxConnAge:         time.Duration(rl.MaxConnAge),
+		IdleCheckFrequency: time.Duration(rl.IdleCheckFrequency),
+		TLSConfig:          tlsConfig,
+		OnConnect:          onConnect(rl.ClientName),
+	}, nil
+}
+
+// tlsConfig 在启用TLS时构造连接所需的 *tls.Config，未启用时返回nil
+func (rl *RedisLogger) tlsConfig() (*tls.Config, error) {
+	if !rl.TLS {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: rl.TLSInsecureSkipVerify,
+	}
+
+	if rl.TLSCACert != "" {
+		pem, err := os.ReadFile(rl.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading TLS CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in %s", rl.TLSCACert)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if rl.TLSClientCert != "" || rl.TLSClientKey != "" {
+		if rl.TLSClientCert == "" || rl.TLSClientKey == "" {
+			return nil, fmt.Errorf("TLS client certificate and key must be configured together")
+		}
+		cert, err := tls.LoadX509KeyPair(rl.TLSClientCert, rl.TLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
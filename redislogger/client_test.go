@@ -0,0 +1,380 @@
+package redislogger
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// selfSignedCert 生成 127.0.0.1 的自签名证书，返回服务端证书与写入PEM的CA文件路径
+func selfSignedCert(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "miniredis"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+func TestTLSConnection(t *testing.T) {
+	cert, caFile := selfSignedCert(t)
+	mr, err := miniredis.RunTLS(&tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.TLS = true
+		rl.TLSCACert = caFile
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	lastEntry(t, mr, "access")
+}
+
+func TestTLSUnknownCA(t *testing.T) {
+	cert, _ := selfSignedCert(t)
+	mr, err := miniredis.RunTLS(&tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	// 系统CA不信任自签名证书，连接失败
+	rl := &RedisLogger{RedisKey: "access", RedisAddress: mr.Addr(), TLS: true, DialTimeout: time.Second}
+	if err := provision(t, rl); err == nil {
+		t.Fatal("expected the handshake to fail without the CA certificate")
+	}
+}
+
+func TestTLSClientCertRequiresKey(t *testing.T) {
+	rl := &RedisLogger{TLS: true, TLSClientCert: "client.pem"}
+	if _, err := rl.tlsConfig(); err == nil {
+		t.Fatal("expected an error for a client certificate without a key")
+	}
+}
+
+func TestRedisURL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisAddress = ""
+		rl.RedisURL = "redis://:secret@" + mr.Addr() + "/2"
+		rl.DialTimeout = 2 * time.Second
+	})
+
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	values, err := mr.DB(2).List("access")
+	if err != nil || len(values) != 1 {
+		t.Fatalf("expected one entry in DB 2, got %v (%v)", values, err)
+	}
+	if mr.Exists("access") {
+		t.Error("entry was written to DB 0")
+	}
+
+	opts, err := rl.redisOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.DialTimeout != 2*time.Second {
+		t.Errorf("dial_timeout not used as default, got %v", opts.DialTimeout)
+	}
+}
+
+func TestRedisURLErrorHidesPassword(t *testing.T) {
+	rl := &RedisLogger{RedisURL: "redis://:hunter2@host:6379/%zz"}
+	_, err := rl.redisOptions()
+	if err == nil {
+		t.Fatal("expected an invalid URL error")
+	}
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error leaks the password: %v", err)
+	}
+}
+
+func TestPoolOptions(t *testing.T) {
+	rl := &RedisLogger{
+		RedisAddress:       "localhost:6379",
+		PoolSize:           20,
+		MinIdleConns:       4,
+		PoolTimeout:        caddy.Duration(2 * time.Second),
+		IdleTimeout:        caddy.Duration(time.Minute),
+		MaxConnAge:         caddy.Duration(time.Hour),
+		IdleCheckFrequency: caddy.Duration(30 * time.Second),
+	}
+	opts, err := rl.redisOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.PoolSize != 20 || opts.MinIdleConns != 4 || opts.PoolTimeout != 2*time.Second ||
+		opts.IdleTimeout != time.Minute || opts.MaxConnAge != time.Hour || opts.IdleCheckFrequency != 30*time.Second {
+		t.Errorf("pool settings not applied: %+v", opts)
+	}
+
+	rl.ClusterAddrs = []string{"localhost:7000"}
+	clusterOpts, err := rl.clusterOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clusterOpts.PoolSize != 20 || clusterOpts.MinIdleConns != 4 || clusterOpts.IdleTimeout != time.Minute {
+		t.Errorf("pool settings not applied to the cluster client: %+v", clusterOpts)
+	}
+}
+
+func TestIdleOptions(t *testing.T) {
+	// -1 表示不关闭空闲连接、不做清理，原样交给go-redis
+	rl := &RedisLogger{
+		RedisAddress:       "localhost:6379",
+		IdleTimeout:        caddy.Duration(-1),
+		MaxConnAge:         caddy.Duration(10 * time.Minute),
+		IdleCheckFrequency: caddy.Duration(-1),
+	}
+	check := func(what string, idle, age, freq time.Duration) {
+		t.Helper()
+		if idle != -1 || age != 10*time.Minute || freq != -1 {
+			t.Errorf("%s: idle_timeout=%v max_conn_age=%v idle_check_frequency=%v", what, idle, age, freq)
+		}
+	}
+
+	opts, err := rl.redisOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("redis.Options", opts.IdleTimeout, opts.MaxConnAge, opts.IdleCheckFrequency)
+
+	rl.RedisURL = "redis://localhost:6379/0"
+	opts, err = rl.redisOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("redis_url", opts.IdleTimeout, opts.MaxConnAge, opts.IdleCheckFrequency)
+
+	rl.RedisURL = ""
+	rl.ClusterAddrs = []string{"localhost:7000"}
+	clusterOpts, err := rl.clusterOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("redis.ClusterOptions", clusterOpts.IdleTimeout, clusterOpts.MaxConnAge, clusterOpts.IdleCheckFrequency)
+}
+
+func TestACLUsername(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("logger", "secret")
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisUsername = "logger"
+		rl.RedisPassword = "secret"
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	lastEntry(t, mr, "access")
+
+	wrong := &RedisLogger{RedisKey: "access", RedisAddress: mr.Addr(), RedisUsername: "other", RedisPassword: "secret"}
+	if err := provision(t, wrong); err == nil {
+		t.Fatal("expected authentication with the wrong user to fail")
+	}
+}
+
+// unixProxy 在Unix域套接字上监听，把连接转发到 addr，用于让miniredis通过套接字访问
+func unixProxy(t *testing.T, addr string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", addr)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			go func() { io.Copy(upstream, conn); upstream.Close() }()
+			go func() { io.Copy(conn, upstream); conn.Close() }()
+		}
+	}()
+	return path
+}
+
+func TestUnixSocket(t *testing.T) {
+	mr := miniredis.RunT(t)
+	path := unixProxy(t, mr.Addr())
+
+	for name, configure := range map[string]func(*RedisLogger){
+		"url":     func(rl *RedisLogger) { rl.RedisAddress = "unix://" + path },
+		"network": func(rl *RedisLogger) { rl.RedisAddress, rl.RedisNetwork = path, "unix" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.RedisKey = "access_" + name
+				configure(rl)
+			})
+			opts, err := rl.redisOptions()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Network != "unix" || opts.Addr != path {
+				t.Errorf("options network/addr = %s %s, want unix %s", opts.Network, opts.Addr, path)
+			}
+			serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+			lastEntry(t, mr, "access_"+name)
+		})
+	}
+}
+
+func TestValidateNetwork(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, rl := range map[string]*RedisLogger{
+		"missing socket": {RedisAddress: "unix:///nonexistent/redis.sock"},
+		"regular file":   {RedisAddress: file, RedisNetwork: "unix"},
+		"bad network":    {RedisAddress: "localhost:6379", RedisNetwork: "udp"},
+	} {
+		if err := rl.validateNetwork(); err == nil {
+			t.Errorf("%s: expected validateNetwork to fail", name)
+		}
+	}
+	if network, addr := (&RedisLogger{RedisAddress: "localhost:6379"}).networkAddress(); network != "tcp" || addr != "localhost:6379" {
+		t.Errorf("default network/addr = %s %s", network, addr)
+	}
+}
+
+func TestClientName(t *testing.T) {
+	for name, tc := range map[string]struct{ configured, want string }{
+		"default": {"", defaultClientName()},
+		"custom":  {"caddy-edge-1", "caddy-edge-1"},
+		"skipped": {"-", ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.ClientName = tc.configured
+				rl.PoolSize = 1
+			})
+			// 连接池只有一个连接，GETNAME 读到的就是 OnConnect 设置的名称
+			got, err := rl.client.get().ClientGetName(context.Background()).Result()
+			if err != nil && err != redis.Nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("connection name = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientNameRejected(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+		if strings.EqualFold(cmd, "CLIENT") && len(args) > 0 && strings.EqualFold(args[0], "SETNAME") {
+			c.WriteError("NOPERM this user has no permissions to run the 'client|setname' command")
+			return true
+		}
+		return false
+	})
+
+	// ACL拒绝 CLIENT SETNAME 时连接照常使用
+	rl := newTestLogger(t, mr, nil)
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	lastEntry(t, mr, "access")
+}
+
+func TestRedisPasswordFile(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+	file := filepath.Join(t.TempDir(), "redis-password")
+	// 文件末尾的换行等首尾空白会被去掉
+	if err := os.WriteFile(file, []byte("  secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisPassword = "ignored"
+		rl.RedisPasswordFile = file
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	lastEntry(t, mr, "access")
+
+	missing := &RedisLogger{RedisKey: "access", RedisAddress: mr.Addr(), RedisPasswordFile: file + ".missing"}
+	if err := provision(t, missing); err == nil || !strings.Contains(err.Error(), "redis_password_file") {
+		t.Errorf("expected a missing password file to be reported, got %v", err)
+	}
+}
+
+func TestCredentialPlaceholders(t *testing.T) {
+	t.Setenv("REDIS_LOGGER_TEST_PASSWORD", "secret")
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+
+	for name, configure := range map[string]func(*RedisLogger){
+		"redis_password": func(rl *RedisLogger) { rl.RedisPassword = "{env.REDIS_LOGGER_TEST_PASSWORD}" },
+		"redis_url": func(rl *RedisLogger) {
+			rl.RedisAddress = ""
+			rl.RedisURL = "redis://:{env.REDIS_LOGGER_TEST_PASSWORD}@" + mr.Addr() + "/0"
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.RedisKey = "access_" + name
+				configure(rl)
+			})
+			serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+			lastEntry(t, mr, "access_"+name)
+		})
+	}
+
+	rl := &RedisLogger{FallbackPassword: "{env.REDIS_LOGGER_TEST_PASSWORD}", RedisPassword: "p{a}ss"}
+	if err := rl.resolveCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if rl.FallbackPassword != "secret" {
+		t.Errorf("fallback_password = %q, want the expanded secret", rl.FallbackPassword)
+	}
+	// 不是已知占位符的花括号保持原样
+	if rl.RedisPassword != "p{a}ss" {
+		t.Errorf("redis_password = %q, want it unchanged", rl.RedisPassword)
+	}
+}
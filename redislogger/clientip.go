@@ -0,0 +1,129 @@
+package redislogger
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// 从 X-Forwarded-For 中选取客户端IP的策略
+const (
+	clientIPLeftmost  = "leftmost"  // 从左往右第一个不受信任的IP，即最初的客户端（默认）
+	clientIPRightmost = "rightmost" // 从右往左第一个不受信任的IP，无法被客户端伪造
+)
+
+// validateClientIPStrategy 检查 ClientIPStrategy 配置是否合法
+func validateClientIPStrategy(strategy string) error {
+	switch strategy {
+	case "", clientIPLeftmost, clientIPRightmost:
+		return nil
+	default:
+		return fmt.Errorf("unsupported client_ip_strategy '%s', expected leftmost or rightmost", strategy)
+	}
+}
+
+// parseTrustedProxies 解析CIDR列表，单个IP视为/32或/128；
+// 与Caddy一样，private_ranges 表示所有私有与回环地址段
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if proxy == "private_ranges" {
+			private, err := parseTrustedProxies(caddyhttp.PrivateRangesCIDR())
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, private...)
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy '%s': %v", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy '%s': %v", proxy, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trusted 判断IP是否属于 TrustedProxies
+func (rl *RedisLogger) trusted(addr netip.Addr) bool {
+	for _, prefix := range rl.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedPeer 判断直连的对端是否为受信任的代理
+func (rl *RedisLogger) trustedPeer(remoteIP string) bool {
+	peer, err := netip.ParseAddr(remoteIP)
+	return err == nil && rl.trusted(peer.Unmap())
+}
+
+// clientIP 从 X-Forwarded-For 链中按 ClientIPStrategy 选出第一个不受信任的IP。
+// 只有对端在 TrustedProxies 中时才采用该请求头，否则客户端可以随意伪造；
+// 对端不受信任、没有该请求头或其中没有可用的IP时返回 remoteIP
+func (rl *RedisLogger) clientIP(r *http.Request, remoteIP string) string {
+	if !rl.trustedPeer(remoteIP) {
+		return remoteIP
+	}
+
+	var chain []netip.Addr
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(header, ",") {
+			addr, err := netip.ParseAddr(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			chain = append(chain, addr.Unmap())
+		}
+	}
+
+	if rl.ClientIPStrategy == clientIPRightmost {
+		for i := len(chain) - 1; i >= 0; i-- {
+			if !rl.trusted(chain[i]) {
+				return chain[i].String()
+			}
+		}
+	} else {
+		for _, addr := range chain {
+			if !rl.trusted(addr) {
+				return addr.String()
+			}
+		}
+	}
+	return remoteIP
+}
+
+// scheme 返回请求的协议：直连时按是否为TLS连接判断；对端在 TrustedProxies 中时
+// 采用 X-Forwarded-Proto（取最左边的值，即最外层代理看到的协议）
+func (rl *RedisLogger) scheme(r *http.Request, remoteIP string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		return scheme
+	}
+	if !rl.trustedPeer(remoteIP) {
+		return scheme
+	}
+	first, _, _ := strings.Cut(proto, ",")
+	switch forwarded := strings.ToLower(strings.TrimSpace(first)); forwarded {
+	case "http", "https":
+		return forwarded
+	}
+	return scheme
+}
@@ -0,0 +1,145 @@
+package redislogger
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newClientIPLogger 返回只初始化了 client_ip 相关配置的 RedisLogger
+func newClientIPLogger(t *testing.T, strategy string, proxies ...string) *RedisLogger {
+	t.Helper()
+	trusted, err := parseTrustedProxies(proxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RedisLogger{ClientIPStrategy: strategy, trustedProxies: trusted}
+}
+
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		strategy string
+		xff      []string
+		want     string
+	}{
+		{"missing header", "", nil, "10.0.0.1"},
+		{"single ip", "", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"multi-hop leftmost", "", []string{"203.0.113.7, 198.51.100.2, 10.0.0.9"}, "203.0.113.7"},
+		{"multi-hop rightmost", clientIPRightmost, []string{"203.0.113.7, 198.51.100.2, 10.0.0.9"}, "198.51.100.2"},
+		{"trusted hops skipped", "", []string{"10.0.0.8, 203.0.113.7"}, "203.0.113.7"},
+		{"repeated headers", clientIPRightmost, []string{"203.0.113.7", "198.51.100.2"}, "198.51.100.2"},
+		{"invalid entries skipped", "", []string{"unknown, 203.0.113.7"}, "203.0.113.7"},
+		{"ipv4-mapped", "", []string{"::ffff:203.0.113.7"}, "203.0.113.7"},
+		{"only trusted", "", []string{"10.0.0.8, 10.0.0.9"}, "10.0.0.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rl := newClientIPLogger(t, tc.strategy, "10.0.0.0/8")
+			r := newTestRequest("GET", "/", nil)
+			for _, xff := range tc.xff {
+				r.Header.Add("X-Forwarded-For", xff)
+			}
+			if got := rl.clientIP(r, "10.0.0.1"); got != tc.want {
+				t.Errorf("clientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := parseTrustedProxies([]string{"10.1.2.3/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32"}
+	for i, prefix := range prefixes {
+		if prefix.String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, prefix, want[i])
+		}
+	}
+	for _, bad := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := parseTrustedProxies([]string{bad}); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	if err := validateClientIPStrategy("middle"); err == nil {
+		t.Error("expected an unknown client_ip_strategy to be rejected")
+	}
+}
+
+func TestClientIPInEntry(t *testing.T) {
+	trusted := []string{"192.0.2.0/24"}
+	for _, tc := range []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		xff        string
+		remoteIP   string
+		clientIP   string
+	}{
+		{"trusted peer", trusted, "192.0.2.1:40000", "203.0.113.7, 192.0.2.10", "192.0.2.1", "203.0.113.7"},
+		// 直连的客户端不在 trusted_proxies 中，伪造的 X-Forwarded-For 被忽略
+		{"untrusted peer", trusted, "198.51.100.9:40000", "203.0.113.7", "198.51.100.9", "198.51.100.9"},
+		// 默认没有受信任的代理，任何对端的 X-Forwarded-For 都不采用
+		{"no trusted proxies", nil, "192.0.2.1:40000", "203.0.113.7", "192.0.2.1", "192.0.2.1"},
+		// 双栈监听时IPv4对端的地址是IPv4映射的IPv6地址，记录与匹配前都先还原为IPv4
+		{"ipv4-mapped trusted peer", trusted, "[::ffff:192.0.2.1]:40000", "203.0.113.7", "192.0.2.1", "203.0.113.7"},
+		{"ipv4-mapped untrusted peer", trusted, "[::ffff:198.51.100.9]:40000", "203.0.113.7", "198.51.100.9", "198.51.100.9"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.TrustedProxies = tc.proxies
+			})
+			r := newTestRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			r.Header.Set("X-Forwarded-For", tc.xff)
+			serve(t, rl, r, respond(200, "", "ok"))
+
+			request := lastEntry(t, mr, "access")["request"].(map[string]any)
+			if request["remote_ip"] != tc.remoteIP || request["client_ip"] != tc.clientIP {
+				t.Errorf("remote_ip = %v, client_ip = %v, want %s and %s", request["remote_ip"], request["client_ip"], tc.remoteIP, tc.clientIP)
+			}
+		})
+	}
+}
+
+func TestSchemeInEntry(t *testing.T) {
+	trusted := []string{"192.0.2.0/24"}
+	for _, tc := range []struct {
+		name       string
+		tls        bool
+		remoteAddr string
+		proto      string
+		scheme     string
+	}{
+		{"plain http", false, "192.0.2.1:40000", "", "http"},
+		{"tls", true, "198.51.100.9:40000", "", "https"},
+		{"forwarded by trusted proxy", false, "192.0.2.1:40000", "https", "https"},
+		{"first of several protos", false, "192.0.2.1:40000", "HTTPS, http", "https"},
+		// 不受信任的对端伪造的 X-Forwarded-Proto 被忽略
+		{"forwarded by untrusted peer", false, "198.51.100.9:40000", "https", "http"},
+		{"unknown proto", true, "192.0.2.1:40000", "gopher", "https"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.TrustedProxies = trusted
+			})
+			r := newTestRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.tls {
+				r.TLS = &tls.ConnectionState{Version: tls.VersionTLS13, HandshakeComplete: true}
+			}
+			if tc.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tc.proto)
+			}
+			serve(t, rl, r, respond(200, "", "ok"))
+
+			if scheme := lastEntry(t, mr, "access")["request"].(map[string]any)["scheme"]; scheme != tc.scheme {
+				t.Errorf("scheme = %v, want %s", scheme, tc.scheme)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package redislogger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// clientPool 在连接参数完全相同的 redis_logger 之间共享客户端，按引用计数，
+// 最后一个使用者释放时关闭。重载配置时新配置会复用旧配置的客户端。
+var clientPool = caddy.NewUsagePool()
+
+// pooledClient 让客户端满足 caddy.Destructor
+type pooledClient struct {
+	redisClient
+}
+
+// Destruct 在最后一个使用者释放后关闭客户端
+func (pc pooledClient) Destruct() error {
+	return pc.Close()
+}
+
+// clientPoolKey 只由影响连接的配置计算共享客户端的key，redis_key 等写入相关的配置不参与；
+// 密码只以哈希的形式出现在key中
+func (rl *RedisLogger) clientPoolKey() (string, error) {
+	params := struct {
+		URL, Address, Network, Username, Password string
+		DB                                        int
+		ClusterAddrs                              []string
+		DialTimeout, ReadTimeout, WriteTimeout    caddy.Duration
+		MaxRetries, PoolSize, MinIdleConns        int
+		PoolTimeout, IdleTimeout, MaxConnAge      caddy.Duration
+		IdleCheckFrequency                        caddy.Duration
+		TLS, TLSInsecureSkipVerify                bool
+		TLSCACert, TLSClientCert, TLSClientKey    string
+		ClientName                                string
+	}{
+		URL:                   rl.RedisURL,
+		Address:               rl.RedisAddress,
+		Network:               rl.RedisNetwork,
+		Username:              rl.RedisUsername,
+		Password:              rl.RedisPassword,
+		DB:                    rl.db(),
+		ClusterAddrs:          rl.ClusterAddrs,
+		DialTimeout:           caddy.Duration(rl.DialTimeout),
+		ReadTimeout:           caddy.Duration(rl.ReadTimeout),
+		WriteTimeout:          caddy.Duration(rl.WriteTimeout),
+		MaxRetries:            rl.MaxRetries,
+		PoolSize:              rl.PoolSize,
+		MinIdleConns:          rl.MinIdleConns,
+		PoolTimeout:           rl.PoolTimeout,
+		IdleTimeout:           rl.IdleTimeout,
+		MaxConnAge:            rl.MaxConnAge,
+		IdleCheckFrequency:    rl.IdleCheckFrequency,
+		TLS:                   rl.TLS,
+		TLSInsecureSkipVerify: rl.TLSInsecureSkipVerify,
+		TLSCACert:             rl.TLSCACert,
+		TLSClientCert:         rl.TLSClientCert,
+		TLSClientKey:          rl.TLSClientKey,
+		ClientName:            rl.ClientName,
+	}
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sharedClient 返回与本实例连接参数相同的共享客户端，没有时新建，
+// 同时返回释放时需要的key
+func (rl *RedisLogger) sharedClient() (redisClient, string, error) {
+	key, err := rl.clientPoolKey()
+	if err != nil {
+		return nil, "", err
+	}
+	val, _, err := clientPool.LoadOrNew(key, func() (caddy.Destructor, error) {
+		client, err := rl.newClient()
+		if err != nil {
+			return nil, err
+		}
+		return pooledClient{client}, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return val.(pooledClient).redisClient, key, nil
+}
+
+// releaseClient 释放不再使用的客户端：共享的客户端减少引用计数，其余的直接关闭
+func releaseClient(client redisClient, poolKey string) error {
+	if poolKey == "" {
+		return client.Close()
+	}
+	_, err := clientPool.Delete(poolKey)
+	return err
+}
@@ -0,0 +1,45 @@
+package redislogger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestSharedClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := newTestLogger(t, mr, func(rl *RedisLogger) { rl.RedisKey = "logs:a" })
+	b := newTestLogger(t, mr, func(rl *RedisLogger) { rl.RedisKey = "logs:b" })
+	db := 1
+	other := newTestLogger(t, mr, func(rl *RedisLogger) { rl.RedisDB = &db })
+
+	// 只有写入的key不同的实例共用一个客户端，连接参数不同时各自一个
+	client := a.client.get()
+	if b.client.get() != client {
+		t.Fatal("loggers that differ only in redis_key should share one client")
+	}
+	if other.client.get() == client {
+		t.Error("loggers with different redis_db should not share a client")
+	}
+
+	// 卸载其中一个不会关闭另一个还在使用的客户端
+	if err := cleanup(a); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Fatalf("shared client closed while still in use: %v", err)
+	}
+	serve(t, b, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	lastEntry(t, mr, "logs:b")
+
+	// 最后一个使用者卸载后关闭
+	if err := cleanup(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx).Err(); err != redis.ErrClosed {
+		t.Errorf("expected the client to be closed after the last logger, ping returned %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package redislogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 压缩后的值以一个标记字节开头，消费端据此判断是否需要解压以及使用哪种算法。
+// JSON以 '{' 开头、msgpack的map以 0x80~0x8f/0xde/0xdf 开头，不会与标记冲突。
+const (
+	markerGzip byte = 0x01
+	markerZstd byte = 0x02
+)
+
+// 支持的压缩算法
+const (
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// 超过该字节数的日志才会被压缩
+const defaultCompressThreshold = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// zstd 的 EncodeAll/DecodeAll 可以并发调用，全局共用一个编码器和解码器
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) { return zstd.NewWriter(nil) })
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) { return zstd.NewReader(nil) })
+)
+
+// validateCompressionAlgo 检查 CompressionAlgo 配置是否合法
+func validateCompressionAlgo(algo string) error {
+	switch algo {
+	case "", compressGzip, compressZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression_algo '%s', expected gzip or zstd", algo)
+	}
+}
+
+// compress 按算法压缩数据，并在开头加上对应的标记字节，默认gzip
+func compress(data []byte, algo string) ([]byte, error) {
+	if algo == compressZstd {
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, []byte{markerZstd}), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(markerGzip)
+
+	zw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(zw)
+	zw.Reset(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// uncompress 根据标记字节还原 compress 的结果，没有压缩标记的数据原样返回
+func uncompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	switch data[0] {
+	case markerGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case markerZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return dec.DecodeAll(data[1:], nil)
+	default:
+		return data, nil
+	}
+}
+
+// maybeCompress 在开启 Compress 且数据超过阈值时压缩
+func (rl *RedisLogger) maybeCompress(data []byte) ([]byte, error) {
+	if !rl.Compress || len(data) <= rl.CompressThreshold {
+		return data, nil
+	}
+	return compress(data, rl.CompressionAlgo)
+}
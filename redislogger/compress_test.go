@@ -0,0 +1,112 @@
+package redislogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty": {},
+		"small": []byte(strings.Repeat(`{"msg":"hello"}`, 100)),
+		"large": []byte(strings.Repeat(`{"msg":"hello","n":12345}`, 64<<10)),
+	}
+	for _, tc := range []struct {
+		algo   string
+		marker byte
+	}{
+		{"", markerGzip},
+		{compressGzip, markerGzip},
+		{compressZstd, markerZstd},
+	} {
+		for name, data := range inputs {
+			compressed, err := compress(data, tc.algo)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", tc.algo, name, err)
+			}
+			if compressed[0] != tc.marker {
+				t.Errorf("%s/%s: marker = %#x, want %#x", tc.algo, name, compressed[0], tc.marker)
+			}
+			if len(data) > 0 && len(compressed) >= len(data) {
+				t.Errorf("%s/%s: compressed %d bytes to %d", tc.algo, name, len(data), len(compressed))
+			}
+			plain, err := uncompress(compressed)
+			if err != nil {
+				t.Fatalf("%s/%s: %v", tc.algo, name, err)
+			}
+			if !bytes.Equal(plain, data) {
+				t.Errorf("%s/%s: round trip changed the data", tc.algo, name)
+			}
+		}
+	}
+
+	// 没有压缩标记的数据原样返回
+	if plain, err := uncompress([]byte(`{"a":1}`)); err != nil || string(plain) != `{"a":1}` {
+		t.Errorf("uncompress of plain JSON = %q, %v", plain, err)
+	}
+}
+
+func TestCompressThreshold(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Compress = true
+		rl.WithResponseBody = true
+		rl.CompressThreshold = 2048
+	})
+
+	serve(t, rl, newTestRequest("GET", "/small", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/large", nil), respond(200, "", strings.Repeat("x", 4096)))
+
+	values, _ := mr.List("access")
+	if len(values) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(values))
+	}
+	large, small := []byte(values[0]), []byte(values[1])
+	if small[0] != '{' {
+		t.Errorf("entry below the threshold was compressed")
+	}
+	if large[0] != markerGzip {
+		t.Fatalf("entry above the threshold was not gzip compressed")
+	}
+	plain, err := uncompress(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(plain, &entry); err != nil {
+		t.Fatalf("decompressed entry is not JSON: %v", err)
+	}
+	if entry["response_body"] != strings.Repeat("x", 4096) {
+		t.Error("response_body lost in compression")
+	}
+}
+
+func TestCompressZstdEntry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Compress = true
+		rl.CompressionAlgo = compressZstd
+		rl.CompressThreshold = 1
+	})
+	serve(t, rl, newTestRequest("GET", "/zstd", nil), respond(200, "", "ok"))
+
+	values, _ := mr.List("access")
+	if len(values) != 1 || values[0][0] != markerZstd {
+		t.Fatalf("expected one zstd compressed entry, got %q", values)
+	}
+	plain, err := uncompress([]byte(values[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(plain, &entry); err != nil || entry["request"].(map[string]any)["uri"] != "/zstd" {
+		t.Errorf("unexpected decompressed entry %s: %v", plain, err)
+	}
+	if err := validateCompressionAlgo("brotli"); err == nil {
+		t.Error("expected an unknown compression_algo to be rejected")
+	}
+}
@@ -0,0 +1,90 @@
+package redislogger
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestCaddyfileRedisDB(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		redis_db 3
+	}`)
+	if rl.RedisDB == nil || *rl.RedisDB != 3 {
+		t.Fatalf("redis_db = %v, want 3", rl.RedisDB)
+	}
+
+	mr := miniredis.RunT(t)
+	rl.RedisAddress = mr.Addr()
+	if err := provision(t, rl); err != nil {
+		t.Fatal(err)
+	}
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if values, _ := mr.DB(3).List("access"); len(values) != 1 {
+		t.Errorf("expected the entry in DB 3, got %d", len(values))
+	}
+	if mr.Exists("access") {
+		t.Error("entry was also written to DB 0")
+	}
+}
+
+func TestRedisDBRange(t *testing.T) {
+	mr := miniredis.RunT(t)
+	for _, tc := range []struct {
+		db, databases int
+		ok            bool
+	}{
+		{15, 0, true},
+		{16, 0, false},
+		{-1, 0, false},
+		{20, 32, true},
+		{32, 32, false},
+	} {
+		db := tc.db
+		rl := &RedisLogger{RedisKey: "access", RedisAddress: mr.Addr(), RedisDB: &db, RedisDatabases: tc.databases}
+		err := provision(t, rl)
+		if (err == nil) != tc.ok {
+			t.Errorf("redis_db %d with databases %d: err = %v", tc.db, tc.databases, err)
+		}
+	}
+}
+
+func TestExplicitDBZero(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		redis_db 0
+	}`)
+	if rl.RedisDB == nil {
+		t.Fatal("explicit redis_db 0 was dropped while parsing")
+	}
+
+	// 显式的0在JSON配置中保留，未设置时省略
+	data, err := json.Marshal(rl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"redis_db":0`) {
+		t.Errorf("explicit redis_db 0 missing from %s", data)
+	}
+	var decoded RedisLogger
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.RedisDB == nil || *decoded.RedisDB != 0 {
+		t.Errorf("redis_db after a JSON round trip = %v, want 0", decoded.RedisDB)
+	}
+	if data, _ := json.Marshal(&RedisLogger{RedisKey: "access"}); strings.Contains(string(data), "redis_db") {
+		t.Errorf("unset redis_db should be omitted, got %s", data)
+	}
+
+	// Provision不会改写显式的0，集群模式也接受DB 0
+	mr := miniredis.RunT(t)
+	rl.ClusterAddrs = []string{mr.Addr()}
+	if err := provision(t, rl); err != nil {
+		t.Fatal(err)
+	}
+	if rl.RedisDB == nil || *rl.RedisDB != 0 {
+		t.Errorf("redis_db after Provision = %v, want 0", rl.RedisDB)
+	}
+}
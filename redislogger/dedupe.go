@@ -0,0 +1,151 @@
+package redislogger
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 去重的默认参数
+const defaultDedupeWindow = time.Second
+
+// 默认按这些字段判断两条日志是否相同
+var defaultDedupeFields = []string{
+	"request.client_ip",
+	"request.method",
+	"request.host",
+	"request.uri",
+	"request.headers.User-Agent",
+	"status",
+}
+
+// deduper 合并窗口内相同的日志：第一条日志先暂存，窗口结束时带上 count 写入，
+// 窗口内的重复日志只增加计数
+type deduper struct {
+	mu      sync.Mutex
+	window  time.Duration
+	fields  []string
+	pending map[uint64]*dedupeGroup
+	closed  bool
+	// emitting 是已经从 pending 取出、正在由定时器写入的分组，flush 要等它们写完
+	emitting sync.WaitGroup
+	// afterFunc 在窗口结束时调用 f，返回停止定时器的函数；默认为 time.AfterFunc，测试中替换为手动触发
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
+}
+
+// dedupeGroup 是窗口内暂存的一条日志
+type dedupeGroup struct {
+	entry   accessEntry
+	keys    []string
+	elapsed time.Duration
+	stats   *requestStats
+	count   int
+	stop    func() bool
+}
+
+// newDeduper 创建去重器，未配置时使用默认的窗口与字段
+func newDeduper(window time.Duration, fields []string) *deduper {
+	if window <= 0 {
+		window = defaultDedupeWindow
+	}
+	if len(fields) == 0 {
+		fields = defaultDedupeFields
+	}
+	return &deduper{
+		window:  window,
+		fields:  fields,
+		pending: make(map[uint64]*dedupeGroup),
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+	}
+}
+
+// hash 计算日志在去重字段上的哈希，字段名为展开后的点分隔形式
+func (dd *deduper) hash(entry *accessEntry) uint64 {
+	flat := make(map[string]string)
+	flatten("", entry.toMap(), flat)
+
+	h := fnv.New64a()
+	for _, field := range dd.fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+		h.Write([]byte(flat[field]))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// hold 接管这条日志：窗口内已有相同的日志时只增加计数，否则复制一份暂存，
+// 窗口结束后写入。返回false表示去重器已关闭，调用方应直接写入。
+func (dd *deduper) hold(rl *RedisLogger, entry *accessEntry, keys []string, elapsed time.Duration, stats *requestStats) bool {
+	sum := dd.hash(entry)
+
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+	if dd.closed {
+		return false
+	}
+	if group, ok := dd.pending[sum]; ok {
+		group.count++
+		return true
+	}
+
+	// entry 来自对象池，请求结束后会被清空，这里保存一份拷贝
+	group := &dedupeGroup{
+		entry:   *entry,
+		keys:    keys,
+		elapsed: elapsed,
+		stats:   stats,
+		count:   1,
+	}
+	dd.pending[sum] = group
+	group.stop = dd.afterFunc(dd.window, func() {
+		dd.mu.Lock()
+		if dd.pending[sum] != group {
+			dd.mu.Unlock()
+			return
+		}
+		delete(dd.pending, sum)
+		dd.emitting.Add(1)
+		dd.mu.Unlock()
+		defer dd.emitting.Done()
+		rl.emitGroup(group)
+	})
+	return true
+}
+
+// flush 在 Cleanup 时立即写入所有暂存的日志，之后的日志不再去重。
+// 仍在 pending 中的分组都由这里写入：定时器即使已经触发，回调拿到锁后发现分组不在了也会跳过。
+// 最后等待回调中正在写入的分组，保证返回后不再有日志写入。
+func (dd *deduper) flush(rl *RedisLogger) {
+	dd.mu.Lock()
+	dd.closed = true
+	groups := make([]*dedupeGroup, 0, len(dd.pending))
+	for sum, group := range dd.pending {
+		group.stop()
+		groups = append(groups, group)
+		delete(dd.pending, sum)
+	}
+	dd.mu.Unlock()
+
+	for _, group := range groups {
+		rl.emitGroup(group)
+	}
+	dd.emitting.Wait()
+}
+
+// emitGroup 写入合并后的日志，有重复时带上 count
+func (rl *RedisLogger) emitGroup(group *dedupeGroup) {
+	if group.count > 1 {
+		group.entry.Count = group.count
+		if group.stats != nil {
+			group.stats.requests = group.count
+		}
+	}
+	if err := rl.emit(&group.entry, group.keys, group.elapsed, group.stats); err != nil {
+		rl.logger.Error("Error writing deduplicated entry", zap.Error(err))
+	}
+}
@@ -0,0 +1,108 @@
+package redislogger
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// manualTimers 替换 deduper.afterFunc，窗口结束的回调只在测试调用 fire 时执行
+type manualTimers struct {
+	mu        sync.Mutex
+	callbacks []func()
+	stopped   bool // stop 的返回值，false 表示定时器已经触发、回调还没拿到锁
+}
+
+func (mt *manualTimers) afterFunc(_ time.Duration, f func()) func() bool {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.callbacks = append(mt.callbacks, f)
+	return func() bool { return mt.stopped }
+}
+
+// fire 执行所有已注册的回调
+func (mt *manualTimers) fire() {
+	mt.mu.Lock()
+	callbacks := mt.callbacks
+	mt.callbacks = nil
+	mt.mu.Unlock()
+	for _, f := range callbacks {
+		f()
+	}
+}
+
+// newDedupeLogger 创建开启去重、定时器由测试控制的 RedisLogger
+func newDedupeLogger(t *testing.T, mr *miniredis.Miniredis) (*RedisLogger, *manualTimers) {
+	t.Helper()
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Dedupe = true
+	})
+	timers := &manualTimers{stopped: true}
+	rl.dedupe.afterFunc = timers.afterFunc
+	return rl, timers
+}
+
+func TestDedupe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl, timers := newDedupeLogger(t, mr)
+
+	serve(t, rl, newTestRequest("GET", "/a", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/a", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/b", nil), respond(200, "", "ok"))
+	if n := listLen(mr, "access"); n != 0 {
+		t.Fatalf("%d entries written before the window ended", n)
+	}
+
+	timers.fire()
+	counts := make(map[any]any)
+	for _, entry := range entries(t, mr, "access") {
+		counts[entry["request"].(map[string]any)["uri"]] = entry["count"]
+	}
+	// 重复的日志只写一条并带上 count，没有重复的不带 count
+	if len(counts) != 2 || counts["/a"] != float64(2) || counts["/b"] != nil {
+		t.Errorf("unexpected entries and counts %v", counts)
+	}
+}
+
+func TestDedupeFlushRace(t *testing.T) {
+	for name, stopped := range map[string]bool{
+		"timer stopped": true,
+		// 定时器已经触发，回调还在等锁，flush 仍要写入这一组
+		"timer already fired": false,
+	} {
+		t.Run(name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl, timers := newDedupeLogger(t, mr)
+			timers.stopped = stopped
+
+			serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+			serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+			rl.dedupe.flush(rl)
+			// 迟到的回调发现分组已被 flush 取走，不会再写一次
+			timers.fire()
+
+			entry := lastEntry(t, mr, "access")
+			if entry["count"] != float64(2) {
+				t.Errorf("count = %v, want 2", entry["count"])
+			}
+		})
+	}
+
+	t.Run("callback before flush", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl, timers := newDedupeLogger(t, mr)
+
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+		timers.fire()
+		rl.dedupe.flush(rl)
+		lastEntry(t, mr, "access")
+
+		// flush 之后不再去重，日志直接写入
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+		if n := listLen(mr, "access"); n != 2 {
+			t.Errorf("got %d entries, want 2", n)
+		}
+	})
+}
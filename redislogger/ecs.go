@@ -0,0 +1,186 @@
+package redislogger
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的 OutputSchema
+const (
+	schemaNative = "native" // 本插件自己的字段结构（默认）
+	schemaECS    = "ecs"    // Elastic Common Schema
+)
+
+// ecsVersion 是生成文档时遵循的ECS版本
+const ecsVersion = "8.11.0"
+
+// validateOutputSchema 检查 OutputSchema 配置是否合法
+func validateOutputSchema(schema string) error {
+	switch schema {
+	case "", schemaNative, schemaECS:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output_schema '%s', expected native or ecs", schema)
+	}
+}
+
+// ecsEntry 把原生结构的日志转换为ECS文档。
+// 已知字段映射到对应的ECS字段，其余顶层字段原样保留；event.duration 为纳秒。
+func ecsEntry(entry map[string]interface{}, elapsed time.Duration) map[string]interface{} {
+	doc := map[string]interface{}{
+		"ecs": map[string]interface{}{"version": ecsVersion},
+	}
+	event := map[string]interface{}{
+		"kind":     "event",
+		"category": []string{"web"},
+	}
+	httpReq := map[string]interface{}{}
+	httpResp := map[string]interface{}{}
+	httpDoc := map[string]interface{}{}
+
+	for key, value := range entry {
+		switch key {
+		case "ts":
+			doc["@timestamp"] = value
+		case "received_at":
+			event["start"] = value
+		case "duration":
+			event["duration"] = elapsed.Nanoseconds()
+		case "request":
+			req, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ecsRequest(doc, httpDoc, httpReq, req)
+		case "bytes_read":
+			setNested(httpReq, "body", "bytes", value)
+		case "request_body":
+			setNested(httpReq, "body", "content", value)
+		case "request_id":
+			httpReq["id"] = value
+		case "status":
+			httpResp["status_code"] = value
+		case "size":
+			setNested(httpResp, "body", "bytes", value)
+		case "response_body":
+			setNested(httpResp, "body", "content", value)
+		case "resp_headers":
+			httpResp["headers"] = value
+		case "upstream":
+			doc["destination"] = map[string]interface{}{"address": value}
+		case "server":
+			server, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, ok := server["name"]; ok {
+				doc["service"] = map[string]interface{}{"name": name}
+			}
+			if vars, ok := server["vars"]; ok {
+				doc["labels"] = vars
+			}
+		default:
+			doc[key] = value
+		}
+	}
+
+	if len(httpReq) > 0 {
+		httpDoc["request"] = httpReq
+	}
+	if len(httpResp) > 0 {
+		httpDoc["response"] = httpResp
+	}
+	if len(httpDoc) > 0 {
+		doc["http"] = httpDoc
+	}
+	doc["event"] = event
+	return doc
+}
+
+// ecsRequest 映射 request 对象中的字段
+func ecsRequest(doc, httpDoc, httpReq, req map[string]interface{}) {
+	source := map[string]interface{}{}
+	urlDoc := map[string]interface{}{}
+
+	for key, value := range req {
+		switch key {
+		case "remote_ip":
+			source["ip"] = value
+		case "remote_port":
+			if port, err := strconv.Atoi(fmt.Sprint(value)); err == nil {
+				source["port"] = port
+			}
+		case "client_ip":
+			doc["client"] = map[string]interface{}{"ip": value}
+		case "proto":
+			// HTTP/1.1 -> 1.1
+			httpDoc["version"] = strings.TrimPrefix(fmt.Sprint(value), "HTTP/")
+		case "method":
+			httpReq["method"] = value
+		case "host":
+			urlDoc["domain"] = value
+		case "scheme":
+			urlDoc["scheme"] = value
+		case "uri":
+			uri := fmt.Sprint(value)
+			urlDoc["original"] = uri
+			if u, err := url.ParseRequestURI(uri); err == nil {
+				urlDoc["path"] = u.Path
+				if u.RawQuery != "" {
+					urlDoc["query"] = u.RawQuery
+				}
+			}
+		case "headers":
+			httpReq["headers"] = value
+		case "tls":
+			tlsInfo, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			tlsDoc := map[string]interface{}{}
+			for k, v := range tlsInfo {
+				switch k {
+				case "resumed":
+					tlsDoc["resumed"] = v
+				case "version":
+					tlsDoc["version"] = v
+				case "cipher_suite":
+					tlsDoc["cipher"] = v
+				case "proto":
+					tlsDoc["next_protocol"] = v
+				case "server_name":
+					setNested(tlsDoc, "client", "server_name", v)
+				case "client_cert_subject":
+					setNested(tlsDoc, "client", "subject", v)
+				case "client_cert_serial":
+					setNested(tlsDoc, "client", "x509.serial_number", v)
+				default:
+					tlsDoc[k] = v
+				}
+			}
+			doc["tls"] = tlsDoc
+		default:
+			httpReq[key] = value
+		}
+	}
+
+	if len(source) > 0 {
+		doc["source"] = source
+	}
+	if len(urlDoc) > 0 {
+		doc["url"] = urlDoc
+	}
+}
+
+// setNested 设置 m[outer][inner]，outer 不存在时创建
+func setNested(m map[string]interface{}, outer, inner string, value interface{}) {
+	nested, ok := m[outer].(map[string]interface{})
+	if !ok {
+		nested = map[string]interface{}{}
+		m[outer] = nested
+	}
+	nested[inner] = value
+}
@@ -0,0 +1,89 @@
+package redislogger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestECSEntry(t *testing.T) {
+	entry := map[string]interface{}{
+		"ts":       "2024-06-01T12:00:00Z",
+		"duration": 0.25,
+		"status":   404,
+		"size":     12,
+		"upstream": "10.0.0.5:8080",
+		"slow":     true,
+		"request": map[string]interface{}{
+			"remote_ip":   "192.0.2.1",
+			"remote_port": "54321",
+			"client_ip":   "203.0.113.7",
+			"proto":       "HTTP/1.1",
+			"method":      "GET",
+			"host":        "example.com",
+			"scheme":      "https",
+			"uri":         "/items?id=1",
+		},
+		"server": map[string]interface{}{
+			"name": "srv0",
+			"vars": map[string]interface{}{"route": "api"},
+		},
+	}
+	want := map[string]interface{}{
+		"@timestamp": "2024-06-01T12:00:00Z",
+		"ecs":        map[string]interface{}{"version": ecsVersion},
+		"event": map[string]interface{}{
+			"kind":     "event",
+			"category": []string{"web"},
+			"duration": int64(250 * time.Millisecond),
+		},
+		"http": map[string]interface{}{
+			"version":  "1.1",
+			"request":  map[string]interface{}{"method": "GET"},
+			"response": map[string]interface{}{"status_code": 404, "body": map[string]interface{}{"bytes": 12}},
+		},
+		"source":      map[string]interface{}{"ip": "192.0.2.1", "port": 54321},
+		"client":      map[string]interface{}{"ip": "203.0.113.7"},
+		"url":         map[string]interface{}{"domain": "example.com", "scheme": "https", "original": "/items?id=1", "path": "/items", "query": "id=1"},
+		"destination": map[string]interface{}{"address": "10.0.0.5:8080"},
+		"service":     map[string]interface{}{"name": "srv0"},
+		"labels":      map[string]interface{}{"route": "api"},
+		"slow":        true,
+	}
+	if got := ecsEntry(entry, 250*time.Millisecond); !reflect.DeepEqual(got, want) {
+		t.Errorf("ecsEntry =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestECSOutputSchema(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputSchema = schemaECS
+	})
+	serve(t, rl, newTestRequest("POST", "/items?id=1", nil), respond(201, "", "ok"))
+
+	doc := lastEntry(t, mr, "access")
+	httpDoc := doc["http"].(map[string]any)
+	if httpDoc["request"].(map[string]any)["method"] != "POST" ||
+		httpDoc["response"].(map[string]any)["status_code"] != float64(201) {
+		t.Errorf("unexpected http object %v", httpDoc)
+	}
+	if doc["url"].(map[string]any)["path"] != "/items" || doc["source"].(map[string]any)["ip"] != "192.0.2.1" {
+		t.Errorf("unexpected url or source in %v", doc)
+	}
+	if _, ok := doc["event"].(map[string]any)["duration"].(float64); !ok {
+		t.Errorf("event.duration missing in %v", doc["event"])
+	}
+	// 原生结构的字段不再出现
+	for _, native := range []string{"ts", "request", "status"} {
+		if _, ok := doc[native]; ok {
+			t.Errorf("native field %s left in the ECS document", native)
+		}
+	}
+
+	if err := validateOutputSchema("otel"); err == nil {
+		t.Error("expected an unknown output_schema to be rejected")
+	}
+}
@@ -0,0 +1,267 @@
+package redislogger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// splitRemoteAddr 把 r.RemoteAddr 拆成IP与端口，地址中没有端口时端口为空。
+// IPv4映射的IPv6地址（::ffff:1.2.3.4）还原为IPv4，与 client_ip 的写法一致。
+func splitRemoteAddr(remoteAddr string) (ip, port string) {
+	ip, port, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip, port = strings.Trim(remoteAddr, "[]"), ""
+	}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		ip = addr.Unmap().String()
+	}
+	return ip, port
+}
+
+// selectFields 只保留 Fields 中列出的顶层字段，未配置 Fields 时保留全部字段
+func (rl *RedisLogger) selectFields(entry map[string]interface{}) {
+	if rl.fieldSet == nil {
+		return
+	}
+	for key := range entry {
+		if _, ok := rl.fieldSet[key]; !ok {
+			delete(entry, key)
+		}
+	}
+}
+
+// renameFields 按 FieldMap 重命名字段，包括嵌套对象中的字段。
+// FieldMap 的key可以是字段名（匹配任意层级），也可以是 request.method 这样的完整路径，
+// 完整路径优先。未映射的字段保持不变。
+// 返回新的map，原始日志保持不变，超长截断时还要基于原始字段重新序列化。
+func (rl *RedisLogger) renameFields(entry map[string]interface{}, prefix string) map[string]interface{} {
+	if len(rl.FieldMap) == 0 {
+		return entry
+	}
+	renamed := make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = rl.renameFields(nested, path)
+		}
+
+		newKey, ok := rl.FieldMap[path]
+		if !ok {
+			newKey, ok = rl.FieldMap[key]
+		}
+		if !ok {
+			newKey = key
+		}
+		renamed[newKey] = value
+	}
+	return renamed
+}
+
+// formatTime 按 TimeFormat 格式化时间：unix、unix_ms、unix_nano 输出整数，
+// 其余值作为Go的时间布局，默认 RFC3339Nano
+func (rl *RedisLogger) formatTime(t time.Time) interface{} {
+	switch rl.TimeFormat {
+	case "":
+		return t.Format(time.RFC3339Nano)
+	case "unix":
+		return t.Unix()
+	case "unix_ms":
+		return t.UnixMilli()
+	case "unix_nano":
+		return t.UnixNano()
+	default:
+		return t.Format(rl.TimeFormat)
+	}
+}
+
+// reverse_proxy 选定上游后把 reverseproxy.DialInfo 放在这个Caddy变量里，
+// 直接读变量可以避免引入整个 reverseproxy 包
+const dialInfoVarKey = "reverse_proxy.dial_info"
+
+// upstreamAddr 返回 reverse_proxy 本次请求使用的上游地址，没有经过代理时返回空字符串
+func upstreamAddr(r *http.Request) string {
+	dialInfo, ok := caddyhttp.GetVar(r.Context(), dialInfoVarKey).(fmt.Stringer)
+	if !ok {
+		return ""
+	}
+	return dialInfo.String()
+}
+
+// 支持的 DurationUnit
+const (
+	durationSeconds = "seconds"
+	durationMillis  = "ms"
+	durationNanos   = "ns"
+)
+
+// validateDurationUnit 检查 DurationUnit 配置是否合法
+func validateDurationUnit(unit string) error {
+	switch unit {
+	case "", durationSeconds, durationMillis, durationNanos:
+		return nil
+	default:
+		return fmt.Errorf("unsupported duration_unit '%s', expected seconds, ms or ns", unit)
+	}
+}
+
+// formatDuration 按 DurationUnit 输出耗时：seconds 为浮点秒数（默认），ms 与 ns 为整数
+func (rl *RedisLogger) formatDuration(d time.Duration) interface{} {
+	switch rl.DurationUnit {
+	case durationMillis:
+		return d.Milliseconds()
+	case durationNanos:
+		return d.Nanoseconds()
+	default:
+		return d.Seconds()
+	}
+}
+
+// geoInfo 按 GeoHeaders 把CDN传来的地理位置请求头映射为 geo 对象的字段，
+// 没有任何映射的请求头时返回nil
+func (rl *RedisLogger) geoInfo(r *http.Request) map[string]string {
+	var geo map[string]string
+	for header, field := range rl.GeoHeaders {
+		value := r.Header.Get(header)
+		if value == "" {
+			continue
+		}
+		if geo == nil {
+			geo = make(map[string]string, len(rl.GeoHeaders))
+		}
+		geo[field] = value
+	}
+	return geo
+}
+
+// resolveMetadata 在加载配置时展开 Metadata 值中的全局占位符（如 {env.DC}、{system.hostname}），
+// 没有配置时返回nil
+func resolveMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+	repl := caddy.NewReplacer()
+	meta := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		meta[k] = repl.ReplaceKnown(v, "")
+	}
+	return meta
+}
+
+// headerBytes 估算响应头的字节数：状态行、每个 "Key: value\r\n" 以及结尾的空行。
+// HTTP/2 与 HTTP/3 会压缩头部，实际传输的字节数会更少。
+func headerBytes(proto string, status int, header http.Header) int64 {
+	// 如 "HTTP/1.1 200 OK\r\n"
+	n := len(proto) + 1 + 3 + 1 + len(http.StatusText(status)) + 2
+	for key, values := range header {
+		for _, value := range values {
+			n += len(key) + 2 + len(value) + 2
+		}
+	}
+	return int64(n + 2)
+}
+
+// declaredContentLength 返回响应头中声明的 Content-Length。
+// HEAD 请求与 1xx、204、304 响应本来就没有响应体，没有声明或无法解析时都返回-1。
+func declaredContentLength(method string, status int, header http.Header) int64 {
+	if method == http.MethodHead || status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		return -1
+	}
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || size < 0 {
+		return -1
+	}
+	return size
+}
+
+// serverInfo 返回处理本次请求的server名称，以及 CaptureVars 中列出的Caddy变量，
+// 不在上下文中的变量不会记录
+func (rl *RedisLogger) serverInfo(r *http.Request) map[string]interface{} {
+	info := make(map[string]interface{}, 2)
+	if srv, ok := r.Context().Value(caddyhttp.ServerCtxKey).(*caddyhttp.Server); ok {
+		info["name"] = srv.Name()
+	}
+	if len(rl.CaptureVars) > 0 {
+		vars := make(map[string]interface{}, len(rl.CaptureVars))
+		for _, name := range rl.CaptureVars {
+			if value := caddyhttp.GetVar(r.Context(), name); value != nil {
+				vars[name] = value
+			}
+		}
+		info["vars"] = vars
+	}
+	return info
+}
+
+// requestID 从 RequestIDHeader 读取请求ID，没有时生成UUID并写回请求头，
+// 让下游服务拿到同一个ID。未配置 RequestIDHeader 时返回空字符串。
+func (rl *RedisLogger) requestID(w http.ResponseWriter, r *http.Request) string {
+	if rl.RequestIDHeader == "" {
+		return ""
+	}
+	id := r.Header.Get(rl.RequestIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+		r.Header.Set(rl.RequestIDHeader, id)
+	}
+	if rl.RequestIDResponse {
+		w.Header().Set(rl.RequestIDHeader, id)
+	}
+	return id
+}
+
+// requestUUID 取Caddy为请求分配的UUID，即请求变量 uuid。
+// Caddy在第一次用到时才生成UUID（变量是惰性的 fmt.Stringer），这里和 {http.request.uuid} 占位符一样
+// 把它加到Caddy自己访问日志的 uuid 字段，两边的日志可以关联。
+// 不直接用占位符：它对变量类型与 ExtraLogFields 做了不检查的类型断言，缺少时会panic。
+// 没有该变量或类型不对时返回空字符串。
+func requestUUID(r *http.Request) string {
+	var id string
+	switch v := caddyhttp.GetVar(r.Context(), "uuid").(type) {
+	case string:
+		id = v
+	case fmt.Stringer:
+		id = v.String()
+	default:
+		return ""
+	}
+	if id == "" {
+		return ""
+	}
+	if extra, ok := r.Context().Value(caddyhttp.ExtraLogFieldsCtxKey).(*caddyhttp.ExtraLogFields); ok {
+		extra.Set(zap.String("uuid", id))
+	}
+	return id
+}
+
+// fingerprint 展开 Fingerprint 中的占位符（如 {http.request.method}、
+// {http.request.header.User-Agent}），对结果做FNV-1a哈希，返回16位十六进制字符串。
+// 相同属性的请求得到相同的指纹，可用于识别爬虫等重复的客户端。
+func (rl *RedisLogger) fingerprint(r *http.Request) string {
+	if len(rl.Fingerprint) == 0 {
+		return ""
+	}
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		return ""
+	}
+	h := fnv.New64a()
+	for _, attr := range rl.Fingerprint {
+		h.Write([]byte(repl.ReplaceKnown(attr, "")))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
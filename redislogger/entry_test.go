@@ -0,0 +1,575 @@
+package redislogger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/reverseproxy"
+	"github.com/google/uuid"
+)
+
+func TestSplitRemoteAddr(t *testing.T) {
+	for _, tc := range []struct {
+		addr, ip, port string
+	}{
+		{"192.0.2.1:54321", "192.0.2.1", "54321"},
+		{"[2001:db8::1]:443", "2001:db8::1", "443"},
+		{"[::ffff:192.0.2.1]:8080", "192.0.2.1", "8080"},
+		{"192.0.2.1", "192.0.2.1", ""},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+		{"@", "@", ""},
+	} {
+		ip, port := splitRemoteAddr(tc.addr)
+		if ip != tc.ip || port != tc.port {
+			t.Errorf("splitRemoteAddr(%q) = %q, %q; want %q, %q", tc.addr, ip, port, tc.ip, tc.port)
+		}
+	}
+}
+
+func TestRemotePortFromRemoteAddr(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, nil)
+
+	// URL中的端口是服务端端口，不能当作客户端端口
+	r := newTestRequest("GET", "http://example.com:8443/", nil)
+	r.RemoteAddr = "198.51.100.7:61000"
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	request := lastEntry(t, mr, "access")["request"].(map[string]any)
+	if request["remote_ip"] != "198.51.100.7" || request["remote_port"] != "61000" {
+		t.Errorf("unexpected remote address in %v", request)
+	}
+}
+
+func TestFieldSelection(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Fields = []string{"status", "duration", "request"}
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(201, "", "ok"))
+
+	entry := lastEntry(t, mr, "access")
+	if len(entry) != 3 || entry["status"] != float64(201) || entry["duration"] == nil || entry["request"] == nil {
+		t.Errorf("expected only status, duration and request, got %v", entry)
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 30, 45, 123456789, time.UTC)
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{"", `"2024-06-01T12:30:45.123456789Z"`},
+		{"unix", "1717245045"},
+		{"unix_ms", "1717245045123"},
+		{"unix_nano", "1717245045123456789"},
+		{"2006-01-02 15:04:05", `"2024-06-01 12:30:45"`},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.TimeFormat = tc.format
+				rl.now = func() time.Time { return at }
+			})
+			serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+
+			// 整数时间戳超出float64的精度，按原始JSON比较
+			values, _ := mr.List("access")
+			var entry map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(values[0]), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if string(entry["ts"]) != tc.want {
+				t.Errorf("ts = %s, want %s", entry["ts"], tc.want)
+			}
+		})
+	}
+}
+
+func TestCaptureVars(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.CaptureVars = []string{"route_id", "tenant", "missing"}
+	})
+
+	r := newTestRequest("GET", "/", nil)
+	caddyhttp.SetVar(r.Context(), "route_id", "api-v2")
+	caddyhttp.SetVar(r.Context(), "tenant", 42)
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	server := lastEntry(t, mr, "access")["server"].(map[string]any)
+	vars := server["vars"].(map[string]any)
+	// 不在上下文中的变量不记录
+	want := map[string]any{"route_id": "api-v2", "tenant": float64(42)}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("server.vars = %v, want %v", vars, want)
+	}
+	// 测试请求没有经过caddyhttp.Server，没有server名称
+	if _, ok := server["name"]; ok {
+		t.Errorf("unexpected server name in %v", server)
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	t.Run("present", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.RequestIDHeader = "X-Request-ID"
+		})
+		r := newTestRequest("GET", "/", nil)
+		r.Header.Set("X-Request-ID", "abc-123")
+		w := serve(t, rl, r, respond(200, "", "ok"))
+
+		if id := lastEntry(t, mr, "access")["request_id"]; id != "abc-123" {
+			t.Errorf("request_id = %v, want abc-123", id)
+		}
+		if got := w.Header().Get("X-Request-ID"); got != "" {
+			t.Errorf("request ID written to the response without request_id_response: %q", got)
+		}
+	})
+
+	t.Run("generated", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.RequestIDHeader = "X-Request-ID"
+			rl.RequestIDResponse = true
+		})
+		r := newTestRequest("GET", "/", nil)
+		var forwarded string
+		w := serve(t, rl, r, caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			forwarded = r.Header.Get("X-Request-ID")
+			return nil
+		}))
+
+		id, _ := lastEntry(t, mr, "access")["request_id"].(string)
+		if _, err := uuid.Parse(id); err != nil {
+			t.Fatalf("request_id %q is not a UUID: %v", id, err)
+		}
+		// 生成的ID同时传给下游handler并写回响应
+		if forwarded != id || w.Header().Get("X-Request-ID") != id {
+			t.Errorf("generated ID %q not propagated: request %q, response %q", id, forwarded, w.Header().Get("X-Request-ID"))
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, nil)
+		r := newTestRequest("GET", "/", nil)
+		r.Header.Set("X-Request-ID", "abc-123")
+		serve(t, rl, r, respond(200, "", "ok"))
+
+		if id, ok := lastEntry(t, mr, "access")["request_id"]; ok {
+			t.Errorf("unexpected request_id %v without request_id_header", id)
+		}
+	})
+}
+
+func TestUpstreamAddr(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, nil)
+
+	// 与 reverse_proxy 一样在变量中放入 DialInfo
+	dialInfo := reverseproxy.DialInfo{Network: "tcp", Host: "10.0.0.5", Port: "8080", Address: "10.0.0.5:8080"}
+	r := newTestRequest("GET", "/", nil)
+	caddyhttp.SetVar(r.Context(), dialInfoVarKey, dialInfo)
+	serve(t, rl, r, respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+
+	got := entries(t, mr, "access")
+	if _, ok := got[0]["upstream"]; ok {
+		t.Errorf("upstream should be omitted without a proxied request, got %v", got[0]["upstream"])
+	}
+	if got[1]["upstream"] != dialInfo.String() {
+		t.Errorf("upstream = %v, want %s", got[1]["upstream"], dialInfo.String())
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	d := 1500 * time.Millisecond
+	for _, tc := range []struct {
+		unit string
+		want any
+	}{
+		{"", 1.5},
+		{durationSeconds, 1.5},
+		{durationMillis, int64(1500)},
+		{durationNanos, int64(1500000000)},
+	} {
+		rl := &RedisLogger{DurationUnit: tc.unit}
+		if got := rl.formatDuration(d); got != tc.want {
+			t.Errorf("%q: formatDuration = %v (%T), want %v (%T)", tc.unit, got, got, tc.want, tc.want)
+		}
+	}
+	if err := validateDurationUnit("minutes"); err == nil {
+		t.Error("expected an unknown duration_unit to be rejected")
+	}
+}
+
+func TestDurationUnitInEntry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.DurationUnit = durationNanos
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	}))
+
+	values, _ := mr.List("access")
+	var entry map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(values[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	// 整数单位输出为JSON整数，不带小数点
+	ns, err := strconv.ParseInt(string(entry["duration"]), 10, 64)
+	if err != nil {
+		t.Fatalf("duration %s is not an integer: %v", entry["duration"], err)
+	}
+	if ns < int64(2*time.Millisecond) {
+		t.Errorf("duration = %dns, expected at least 2ms", ns)
+	}
+}
+
+func TestFieldMap(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		field_map {
+			ts @timestamp
+			method http.method
+			request.remote_ip src_ip
+			remote_ip peer_ip
+		}
+	}`)
+	want := map[string]string{"ts": "@timestamp", "method": "http.method", "request.remote_ip": "src_ip", "remote_ip": "peer_ip"}
+	if !reflect.DeepEqual(rl.FieldMap, want) {
+		t.Fatalf("field_map = %v, want %v", rl.FieldMap, want)
+	}
+
+	mr := miniredis.RunT(t)
+	rl.RedisAddress = mr.Addr()
+	if err := provision(t, rl); err != nil {
+		t.Fatal(err)
+	}
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+
+	entry := lastEntry(t, mr, "access")
+	if _, ok := entry["@timestamp"]; !ok {
+		t.Errorf("ts not renamed to @timestamp in %v", entry)
+	}
+	if _, ok := entry["ts"]; ok {
+		t.Errorf("ts still present in %v", entry)
+	}
+	// 完整路径优先于字段名，未映射的字段保持不变
+	request := entry["request"].(map[string]any)
+	if request["http.method"] != "GET" || request["src_ip"] != "192.0.2.1" || request["uri"] != "/" {
+		t.Errorf("unexpected nested fields %v", request)
+	}
+	if _, ok := request["peer_ip"]; ok {
+		t.Errorf("field name mapping used instead of the full path in %v", request)
+	}
+	if entry["status"] != float64(200) {
+		t.Errorf("unmapped status changed in %v", entry)
+	}
+}
+
+func TestClientCertInEntry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, nil)
+
+	cert := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "billing-service", Organization: []string{"Example"}},
+		SerialNumber: big.NewInt(4242),
+	}
+	r := newTestRequest("GET", "https://example.com/", nil)
+	r.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		ServerName:       "example.com",
+		PeerCertificates: []*x509.Certificate{cert},
+	}
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	info := lastEntry(t, mr, "access")["request"].(map[string]any)["tls"].(map[string]any)
+	if info["client_cert_subject"] != "CN=billing-service,O=Example" || info["client_cert_serial"] != "4242" {
+		t.Errorf("unexpected client certificate fields in %v", info)
+	}
+
+	// 没有客户端证书或序列号时不输出对应字段，明文请求没有 tls 对象
+	if got := newAccessTLS(&tls.ConnectionState{}); got.ClientCertSubject != "" || got.ClientCertSerial != "" {
+		t.Errorf("empty chain produced %+v", got)
+	}
+	if got := newAccessTLS(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}); got.ClientCertSerial != "" {
+		t.Errorf("nil serial produced %q", got.ClientCertSerial)
+	}
+	if got := newAccessTLS(nil); got != nil {
+		t.Errorf("plain HTTP produced %+v", got)
+	}
+}
+
+func TestBytesWritten(t *testing.T) {
+	// "HTTP/1.1 200 OK\r\n" 17字节，"Content-Type: text/plain\r\n" 26字节，结尾空行2字节
+	header := http.Header{"Content-Type": {"text/plain"}}
+	if got := headerBytes("HTTP/1.1", http.StatusOK, header); got != 45 {
+		t.Errorf("headerBytes = %d, want 45", got)
+	}
+
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithBytesWritten = true
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "text/plain", "hello"))
+	entry := lastEntry(t, mr, "access")
+	if entry["header_bytes"] != float64(45) || entry["bytes_written"] != float64(50) || entry["size"] != float64(5) {
+		t.Errorf("header_bytes = %v, bytes_written = %v, size = %v; want 45, 50, 5",
+			entry["header_bytes"], entry["bytes_written"], entry["size"])
+	}
+
+	// 默认不输出
+	rl.WithBytesWritten = false
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "text/plain", "hello"))
+	if entry := entries(t, mr, "access")[0]; entry["bytes_written"] != nil || entry["header_bytes"] != nil {
+		t.Errorf("bytes fields logged without with_bytes_written: %v", entry)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Fingerprint = []string{"{http.request.method}", "{http.request.header.User-Agent}"}
+	})
+	for _, ua := range []string{"curl/8.0", "curl/8.0", "Mozilla/5.0"} {
+		r := newTestRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", ua)
+		serve(t, rl, r, respond(200, "", "ok"))
+	}
+
+	// LPUSH写入，最新的在前
+	got := entries(t, mr, "access")
+	browser, curl2, curl1 := got[0]["fingerprint"], got[1]["fingerprint"], got[2]["fingerprint"]
+	if curl1 != curl2 {
+		t.Errorf("identical requests got different fingerprints %v and %v", curl1, curl2)
+	}
+	if browser == curl1 {
+		t.Errorf("different user agents got the same fingerprint %v", browser)
+	}
+
+	// 指纹总是16位十六进制，哈希值较小时补零
+	r := newTestRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "agent/210")
+	if fp := rl.fingerprint(r); fp != "09d54ab38682740e" {
+		t.Errorf("fingerprint = %q, want the zero-padded 09d54ab38682740e", fp)
+	}
+}
+
+func TestRequestUUID(t *testing.T) {
+	t.Run("caddy", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.WithRequestUUID = true
+		})
+		// newTestRequest 与Caddy一样放入惰性生成UUID的 uuid 变量
+		r := newTestRequest("GET", "/", nil)
+		serve(t, rl, r, respond(200, "", "ok"))
+
+		// 变量生成UUID后会记住它，再次读取得到同一个值
+		want := caddyhttp.GetVar(r.Context(), "uuid").(fmt.Stringer).String()
+		if _, err := uuid.Parse(want); err != nil {
+			t.Fatalf("uuid var = %q: %v", want, err)
+		}
+		if got := lastEntry(t, mr, "access")["request_uuid"]; got != want {
+			t.Errorf("request_uuid = %v, want %s", got, want)
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		uuid any
+		want any
+	}{
+		{"string", "0b5ee4b2-9a4c-4d11-b6a1-2f3e1e2c6a7d", "0b5ee4b2-9a4c-4d11-b6a1-2f3e1e2c6a7d"},
+		// 没有该变量或类型不对时不记录，也不能panic
+		{"missing", nil, nil},
+		{"wrong type", 42, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.WithRequestUUID = true
+			})
+			r := newTestRequest("GET", "/", nil)
+			caddyhttp.SetVar(r.Context(), "uuid", tc.uuid)
+			serve(t, rl, r, respond(200, "", "ok"))
+
+			if got := lastEntry(t, mr, "access")["request_uuid"]; got != tc.want {
+				t.Errorf("request_uuid = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequestLine(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithRequestLine = true
+		rl.Redact = []string{"token"}
+	})
+
+	r := newTestRequest("POST", "/search?q=go&token=secret", nil)
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/2.0", 2, 0
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	// 请求行中的URI同样经过脱敏
+	entry := lastEntry(t, mr, "access")
+	if want := "POST /search?q=go&token=REDACTED HTTP/2.0"; entry["request_line"] != want {
+		t.Errorf("request_line = %q, want %q", entry["request_line"], want)
+	}
+	if proto := entry["request"].(map[string]any)["proto"]; proto != "HTTP/2.0" {
+		t.Errorf("proto = %v, want HTTP/2.0", proto)
+	}
+}
+
+func TestReceivedAt(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithReceivedAt = true
+	})
+	slow := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), slow)
+
+	// received_at 是请求到达的时间，ts 是写日志的时间，两者至少相差handler的耗时
+	entry := lastEntry(t, mr, "access")
+	receivedAt, err := time.Parse(time.RFC3339Nano, entry["received_at"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, entry["ts"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := ts.Sub(receivedAt); d < 20*time.Millisecond {
+		t.Errorf("ts - received_at = %v, want at least the handler's 20ms", d)
+	}
+
+	// 未开启时不带 received_at
+	rl = newTestLogger(t, mr, nil)
+	mr.Del("access")
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if _, ok := lastEntry(t, mr, "access")["received_at"]; ok {
+		t.Error("received_at logged without with_received_at")
+	}
+}
+
+func TestQueryObject(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithQuery = true
+		rl.Redact = []string{"token"}
+	})
+	serve(t, rl, newTestRequest("GET", "/search?a=1&a=2&b=x&token=secret", nil), respond(200, "", "ok"))
+
+	// 重复的参数按顺序保留在数组中，需要脱敏的参数打码
+	query := lastEntry(t, mr, "access")["request"].(map[string]any)["query"]
+	want := map[string]any{
+		"a":     []any{"1", "2"},
+		"b":     []any{"x"},
+		"token": []any{redactedValue},
+	}
+	if !reflect.DeepEqual(query, want) {
+		t.Errorf("query = %v, want %v", query, want)
+	}
+
+	// 没有查询参数时不带 query
+	mr.Del("access")
+	serve(t, rl, newTestRequest("GET", "/search", nil), respond(200, "", "ok"))
+	if query, ok := lastEntry(t, mr, "access")["request"].(map[string]any)["query"]; ok {
+		t.Errorf("unexpected query %v", query)
+	}
+}
+
+func TestContentLengthMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		method   string
+		declared string
+		body     string
+		length   any // 不记录 content_length 时为nil
+		mismatch bool
+	}{
+		{"matches", "GET", "5", "hello", float64(5), false},
+		{"short write", "GET", "10", "hello", float64(10), true},
+		// 声明为0也要记录并比较
+		{"declared zero", "GET", "0", "", float64(0), false},
+		{"declared zero with body", "GET", "0", "hello", float64(0), true},
+		{"not declared", "GET", "", "hello", nil, false},
+		{"head", "HEAD", "10", "", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.CheckContentLength = true
+			})
+			next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				if tc.declared != "" {
+					w.Header().Set("Content-Length", tc.declared)
+				}
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write([]byte(tc.body))
+				return err
+			})
+			serve(t, rl, newTestRequest(tc.method, "/", nil), next)
+
+			entry := lastEntry(t, mr, "access")
+			if entry["content_length"] != tc.length {
+				t.Errorf("content_length = %v, want %v", entry["content_length"], tc.length)
+			}
+			if mismatch := entry["content_length_mismatch"] == true; mismatch != tc.mismatch {
+				t.Errorf("content_length_mismatch = %v, want %v", mismatch, tc.mismatch)
+			}
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	t.Setenv("REDIS_LOGGER_TEST_DC", "ams1")
+	mr := miniredis.RunT(t)
+	metadata := map[string]string{
+		"dc":      "{env.REDIS_LOGGER_TEST_DC}",
+		"app":     "shop-{env.REDIS_LOGGER_TEST_DC}",
+		"version": "1.2.3",
+		"request": "{http.request.uri}",
+	}
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Metadata = metadata
+	})
+	serve(t, rl, newTestRequest("GET", "/a", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/b", nil), respond(200, "", "ok"))
+
+	// 全局占位符在加载配置时展开一次，请求相关的占位符不展开
+	want := map[string]any{
+		"dc":      "ams1",
+		"app":     "shop-ams1",
+		"version": "1.2.3",
+		"request": "{http.request.uri}",
+	}
+	for _, entry := range entries(t, mr, "access") {
+		if !reflect.DeepEqual(entry["meta"], want) {
+			t.Errorf("meta = %v, want %v", entry["meta"], want)
+		}
+	}
+	if metadata["dc"] != "{env.REDIS_LOGGER_TEST_DC}" {
+		t.Error("the configured metadata was modified")
+	}
+}
@@ -0,0 +1,132 @@
+package redislogger
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// 切换到备用Redis后，每隔这么久重新尝试主Redis
+const defaultFailbackInterval = 30 * time.Second
+
+// fallbackState 记录备用Redis的客户端以及当前是否正在使用它
+type fallbackState struct {
+	mu          sync.Mutex
+	client      redisClient
+	activeSince time.Time // 为零值时表示正在使用主Redis
+}
+
+// pushBatch 写入主Redis，失败时改写备用Redis。
+// 切换到备用Redis后，每隔 FailbackInterval 才重新尝试一次主Redis，成功后切回。
+func (rl *RedisLogger) pushBatch(ctx context.Context, items []logItem) error {
+	if rl.fallback == nil {
+		return rl.pipelinePush(ctx, rl.client.get(), items)
+	}
+
+	if client, ok := rl.activeFallback(); ok {
+		return rl.pipelinePush(ctx, client, items)
+	}
+
+	err := rl.pipelinePush(ctx, rl.client.get(), items)
+	if err == nil {
+		rl.failback()
+		return nil
+	}
+
+	client, fbErr := rl.failover()
+	if fbErr != nil {
+		rl.logger.Error("Error connecting to fallback Redis", zap.Error(fbErr))
+		return err
+	}
+	return rl.pipelinePush(ctx, client, items)
+}
+
+// activeFallback 在正在使用备用Redis且还没到重试主Redis的时间时返回备用客户端
+func (rl *RedisLogger) activeFallback() (redisClient, bool) {
+	fb := rl.fallback
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if fb.activeSince.IsZero() || rl.now().Sub(fb.activeSince) >= time.Duration(rl.FailbackInterval) {
+		return nil, false
+	}
+	return fb.client, true
+}
+
+// failover 切换到备用Redis，客户端在第一次需要时才创建
+func (rl *RedisLogger) failover() (redisClient, error) {
+	fb := rl.fallback
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if fb.client == nil {
+		opts, err := rl.fallbackOptions()
+		if err != nil {
+			return nil, err
+		}
+		fb.client = redis.NewClient(opts)
+	}
+	if fb.activeSince.IsZero() {
+		rl.logger.Warn("Primary Redis unavailable, writing to fallback",
+			zap.String("fallback_address", rl.FallbackAddress),
+		)
+	}
+	// 每次切换都重新计时，FailbackInterval 之后再试主Redis
+	fb.activeSince = rl.now()
+	return fb.client, nil
+}
+
+// failback 主Redis写入成功后切回主Redis
+func (rl *RedisLogger) failback() {
+	fb := rl.fallback
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if fb.activeSince.IsZero() {
+		return
+	}
+	fb.activeSince = time.Time{}
+	rl.logger.Info("Primary Redis recovered, leaving fallback",
+		zap.String("fallback_address", rl.FallbackAddress),
+	)
+}
+
+// fallbackOptions 构造备用Redis的连接参数，未单独配置的认证信息沿用主Redis的
+func (rl *RedisLogger) fallbackOptions() (*redis.Options, error) {
+	tlsConfig, err := rl.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	username, password := rl.FallbackUsername, rl.FallbackPassword
+	if username == "" && password == "" {
+		username, password = rl.RedisUsername, rl.RedisPassword
+	}
+	return &redis.Options{
+		Addr:               rl.FallbackAddress,
+		Username:           username,
+		Password:           password,
+		DB:                 rl.db(),
+		DialTimeout:        rl.DialTimeout,
+		ReadTimeout:        rl.ReadTimeout,
+		WriteTimeout:       rl.WriteTimeout,
+		MaxRetries:         rl.MaxRetries,
+		PoolSize:           rl.PoolSize,
+		MinIdleConns:       rl.MinIdleConns,
+		PoolTimeout:        time.Duration(rl.PoolTimeout),
+		IdleTimeout:        time.Duration(rl.IdleTimeout),
+		MaxConnAge:         time.Duration(rl.MaxConnAge),
+		IdleCheckFrequency: time.Duration(rl.IdleCheckFrequency),
+		TLSConfig:          tlsConfig,
+		OnConnect:          onConnect(rl.ClientName),
+	}, nil
+}
+
+// close 关闭备用Redis客户端
+func (fb *fallbackState) close() error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if fb.client == nil {
+		return nil
+	}
+	return fb.client.Close()
+}
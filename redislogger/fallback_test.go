@@ -0,0 +1,74 @@
+package redislogger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestFallbackFailoverAndFailback(t *testing.T) {
+	primary := miniredis.RunT(t)
+	fallback := miniredis.RunT(t)
+	fallback.RequireAuth("fallback-secret")
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := newTestLogger(t, primary, func(rl *RedisLogger) {
+		rl.FallbackAddress = fallback.Addr()
+		rl.FallbackPassword = "fallback-secret"
+		rl.FailbackInterval = caddy.Duration(time.Minute)
+		rl.WriteTimeout = 100 * time.Millisecond
+		rl.now = func() time.Time { return clock }
+	})
+
+	serve(t, rl, newTestRequest("GET", "/primary", nil), respond(200, "", "ok"))
+	if rl.fallback.client != nil {
+		t.Error("fallback client created before the primary failed")
+	}
+
+	// 主Redis写入失败时改写备用Redis
+	primary.Close()
+	serve(t, rl, newTestRequest("GET", "/failover", nil), respond(200, "", "ok"))
+	if uri := lastEntry(t, fallback, "access")["request"].(map[string]any)["uri"]; uri != "/failover" {
+		t.Fatalf("fallback entry uri = %v", uri)
+	}
+
+	// 主Redis恢复后，FailbackInterval 之内仍写备用Redis
+	if err := primary.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(30 * time.Second)
+	serve(t, rl, newTestRequest("GET", "/still-fallback", nil), respond(200, "", "ok"))
+	if n := listLen(fallback, "access"); n != 2 {
+		t.Errorf("expected 2 entries on the fallback, got %d", n)
+	}
+
+	// 超过 FailbackInterval 后重试主Redis并切回
+	clock = clock.Add(31 * time.Second)
+	serve(t, rl, newTestRequest("GET", "/failback", nil), respond(200, "", "ok"))
+	got := entries(t, primary, "access")
+	if len(got) != 2 || got[0]["request"].(map[string]any)["uri"] != "/failback" {
+		t.Errorf("expected the primary to receive /failback, got %v", got)
+	}
+	if !rl.fallback.activeSince.IsZero() {
+		t.Error("fallback still active after the primary recovered")
+	}
+}
+
+func TestFallbackOptionsAuth(t *testing.T) {
+	rl := &RedisLogger{RedisUsername: "primary", RedisPassword: "primary-secret", FallbackAddress: "10.0.0.2:6379"}
+	opts, err := rl.fallbackOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未单独配置时沿用主Redis的认证信息
+	if opts.Addr != "10.0.0.2:6379" || opts.Username != "primary" || opts.Password != "primary-secret" {
+		t.Errorf("unexpected fallback options %+v", opts)
+	}
+
+	rl.FallbackPassword = "fallback-secret"
+	if opts, _ := rl.fallbackOptions(); opts.Username != "" || opts.Password != "fallback-secret" {
+		t.Errorf("fallback credentials not used: %q %q", opts.Username, opts.Password)
+	}
+}
@@ -0,0 +1,134 @@
+package redislogger
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// statusRange 是一个闭区间的状态码范围
+type statusRange struct {
+	min, max int
+}
+
+// parseStatusRanges 解析 log_status 等状态码配置，支持 404 与 400-599 两种写法，option 用于错误信息
+func parseStatusRanges(option string, specs []string) ([]statusRange, error) {
+	ranges := make([]statusRange, 0, len(specs))
+	for _, spec := range specs {
+		lo, hi, isRange := strings.Cut(spec, "-")
+		min, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code in %s: %s", option, spec)
+		}
+		max := min
+		if isRange {
+			if max, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("invalid status code in %s: %s", option, spec)
+			}
+		}
+		if min < 100 || max > 599 || min > max {
+			return nil, fmt.Errorf("invalid status range in %s: %s", option, spec)
+		}
+		ranges = append(ranges, statusRange{min: min, max: max})
+	}
+	return ranges, nil
+}
+
+// statusLogged 判断该状态码的响应是否需要记录，未配置 log_status 时全部记录
+func (rl *RedisLogger) statusLogged(status int) bool {
+	if len(rl.statusRanges) == 0 {
+		return true
+	}
+	return inStatusRanges(rl.statusRanges, statusOrOK(status))
+}
+
+// inStatusRanges 判断状态码是否落在任一范围内
+func inStatusRanges(ranges []statusRange, status int) bool {
+	for _, sr := range ranges {
+		if status >= sr.min && status <= sr.max {
+			return true
+		}
+	}
+	return false
+}
+
+// statusOrOK 下游没有写任何内容时 status 为0，此时 net/http 会返回200
+func statusOrOK(status int) int {
+	if status == 0 {
+		return http.StatusOK
+	}
+	return status
+}
+
+// errorStatus 取下游错误对应的状态码，与Caddy处理错误时一致：
+// caddyhttp.HandlerError 带状态码时用它，否则为500
+func errorStatus(err error) int {
+	var handlerErr caddyhttp.HandlerError
+	if errors.As(err, &handlerErr) && handlerErr.StatusCode != 0 {
+		return handlerErr.StatusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// provisionSkipMatchers 基于Caddy自带的path/method匹配器构造跳过规则，
+// 复制一份配置，避免匹配器的Provision修改原始配置
+func (rl *RedisLogger) provisionSkipMatchers(ctx caddy.Context) error {
+	if len(rl.SkipPaths) > 0 {
+		rl.skipPaths = append(caddyhttp.MatchPath(nil), rl.SkipPaths...)
+		if err := rl.skipPaths.Provision(ctx); err != nil {
+			return fmt.Errorf("provisioning skip_paths: %w", err)
+		}
+	}
+	for _, method := range rl.SkipMethods {
+		rl.skipMethods = append(rl.skipMethods, strings.ToUpper(method))
+	}
+	if len(rl.SkipHosts) > 0 {
+		rl.skipHosts = append(caddyhttp.MatchHost(nil), rl.SkipHosts...)
+		if err := rl.skipHosts.Provision(ctx); err != nil {
+			return fmt.Errorf("provisioning skip_hosts: %w", err)
+		}
+	}
+	if len(rl.OnlyHosts) > 0 {
+		rl.onlyHosts = append(caddyhttp.MatchHost(nil), rl.OnlyHosts...)
+		if err := rl.onlyHosts.Provision(ctx); err != nil {
+			return fmt.Errorf("provisioning only_hosts: %w", err)
+		}
+	}
+	return nil
+}
+
+// skipRequest 判断请求是否命中 SkipPaths/SkipMethods/SkipHosts，
+// 或者配置了 OnlyHosts 但不在其中，这些请求不记录
+func (rl *RedisLogger) skipRequest(r *http.Request) bool {
+	if len(rl.onlyHosts) > 0 && !rl.onlyHosts.Match(r) {
+		return true
+	}
+	if len(rl.skipHosts) > 0 && rl.skipHosts.Match(r) {
+		return true
+	}
+	if len(rl.skipPaths) > 0 && rl.skipPaths.Match(r) {
+		return true
+	}
+	if len(rl.skipMethods) > 0 && rl.skipMethods.Match(r) {
+		return true
+	}
+	return false
+}
+
+// sampled 按 SampleRate 决定是否记录本次请求，未配置或为1时全部记录。
+// 开启 SampleKeepErrors 时非2xx响应不参与采样。
+func (rl *RedisLogger) sampled(status int) bool {
+	if rl.SampleRate <= 0 || rl.SampleRate >= 1 {
+		return true
+	}
+	if rl.SampleKeepErrors && (status < 200 || status > 299) && status != 0 {
+		return true
+	}
+	return rand.Float64() < rl.SampleRate
+}
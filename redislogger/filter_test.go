@@ -0,0 +1,214 @@
+package redislogger
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	ranges, err := parseStatusRanges("log_status", []string{"404", "500-599"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for status, want := range map[int]bool{200: false, 404: true, 403: false, 500: true, 503: true, 599: true} {
+		if got := inStatusRanges(ranges, status); got != want {
+			t.Errorf("inStatusRanges(%d) = %v, want %v", status, got, want)
+		}
+	}
+	for _, bad := range []string{"abc", "40x-500", "99", "500-400", "200-600"} {
+		if _, err := parseStatusRanges("log_status", []string{bad}); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestLogStatusFilter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.LogStatus = []string{"400-599"}
+	})
+
+	serve(t, rl, newTestRequest("GET", "/ok", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/missing", nil), respond(404, "", "not found"))
+	// 没有写任何内容时按200处理
+	serve(t, rl, newTestRequest("GET", "/empty", nil), respond(0, "", ""))
+
+	entry := lastEntry(t, mr, "access")
+	if entry["status"] != float64(404) {
+		t.Errorf("expected only the 404 to be logged, got %v", entry)
+	}
+}
+
+func TestLogErrors(t *testing.T) {
+	mr := miniredis.RunT(t)
+	failing := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return caddyhttp.Error(http.StatusBadGateway, errors.New("upstream unreachable"))
+	})
+
+	// 未开启时出错的请求不记录，错误原样返回
+	rl := newTestLogger(t, mr, nil)
+	if err := rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/", nil), failing); err == nil {
+		t.Fatal("expected the handler error to be returned")
+	}
+	if n := listLen(mr, "access"); n != 0 {
+		t.Fatalf("%d entries written with log_errors off", n)
+	}
+
+	rl = newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.LogErrors = true
+	})
+	err := rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/api", nil), failing)
+	var handlerErr caddyhttp.HandlerError
+	if !errors.As(err, &handlerErr) || handlerErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("ServeHTTP returned %v, want the handler error", err)
+	}
+	entry := lastEntry(t, mr, "access")
+	// 没有写响应时状态码取自 HandlerError
+	if entry["status"] != float64(http.StatusBadGateway) {
+		t.Errorf("status = %v, want 502", entry["status"])
+	}
+	if msg, _ := entry["error"].(string); !strings.Contains(msg, "upstream unreachable") {
+		t.Errorf("error = %q, want the handler error message", msg)
+	}
+	if entry["request"].(map[string]any)["uri"] != "/api" {
+		t.Errorf("unexpected request %v", entry["request"])
+	}
+
+	// 普通错误按500记录
+	mr.Del("access")
+	rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/", nil), caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("boom")
+	}))
+	if entry := lastEntry(t, mr, "access"); entry["status"] != float64(http.StatusInternalServerError) || entry["error"] != "boom" {
+		t.Errorf("unexpected entry for a plain error %v", entry)
+	}
+}
+
+func TestSkipPathsAndMethods(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.SkipPaths = []string{"/healthz", "/static/*"}
+		rl.SkipMethods = []string{"options"}
+	})
+
+	skipped := 0
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		skipped++
+		return nil
+	})
+	serve(t, rl, newTestRequest("GET", "/healthz", nil), next)
+	serve(t, rl, newTestRequest("GET", "/static/app.js", nil), next)
+	serve(t, rl, newTestRequest("OPTIONS", "/api", nil), next)
+	if skipped != 3 {
+		t.Fatalf("skipped requests must still reach the next handler, got %d", skipped)
+	}
+	serve(t, rl, newTestRequest("GET", "/api", nil), respond(200, "", "ok"))
+
+	request := lastEntry(t, mr, "access")["request"].(map[string]any)
+	if request["uri"] != "/api" || request["method"] != "GET" {
+		t.Errorf("unexpected logged request %v", request)
+	}
+}
+
+func TestSampled(t *testing.T) {
+	const n = 10000
+	rl := &RedisLogger{SampleRate: 0.25}
+	kept := 0
+	for i := 0; i < n; i++ {
+		if rl.sampled(200) {
+			kept++
+		}
+	}
+	// 期望2500，标准差约43，留足余量避免偶发失败
+	if kept < 2200 || kept > 2800 {
+		t.Errorf("sample_rate 0.25 kept %d of %d", kept, n)
+	}
+
+	for _, rate := range []float64{0, 1} {
+		rl := &RedisLogger{SampleRate: rate}
+		if !rl.sampled(200) {
+			t.Errorf("sample_rate %v must keep every request", rate)
+		}
+	}
+}
+
+func TestSampleKeepErrors(t *testing.T) {
+	rl := &RedisLogger{SampleRate: 0.000001, SampleKeepErrors: true}
+	for _, status := range []int{301, 404, 500} {
+		if !rl.sampled(status) {
+			t.Errorf("status %d should always be kept", status)
+		}
+	}
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		if rl.sampled(200) {
+			kept++
+		}
+	}
+	if kept > 1 {
+		t.Errorf("2xx responses should still be sampled, kept %d of 1000", kept)
+	}
+}
+
+func TestSlowRequestsAlwaysLogged(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.SlowThreshold = caddy.Duration(20 * time.Millisecond)
+		rl.SampleRate = 0.0000001
+		rl.LogStatus = []string{"500-599"}
+	})
+
+	// 快的请求被状态码过滤与采样丢弃
+	serve(t, rl, newTestRequest("GET", "/fast", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/slow", nil), caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	}))
+
+	entry := lastEntry(t, mr, "access")
+	if entry["request"].(map[string]any)["uri"] != "/slow" || entry["slow"] != true {
+		t.Errorf("expected only the slow request, marked slow, got %v", entry)
+	}
+}
+
+func TestHostFilters(t *testing.T) {
+	hosts := []string{"example.com", "api.internal", "db.internal", "other.test"}
+	for _, tc := range []struct {
+		name       string
+		skip, only []string
+		want       []string
+	}{
+		{"none", nil, nil, hosts},
+		{"skip wildcard", []string{"*.internal"}, nil, []string{"example.com", "other.test"}},
+		{"only wildcard", nil, []string{"*.internal"}, []string{"api.internal", "db.internal"}},
+		{"only and skip", []string{"db.internal"}, []string{"*.internal", "example.com"}, []string{"example.com", "api.internal"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.SkipHosts = tc.skip
+				rl.OnlyHosts = tc.only
+			})
+			for _, host := range hosts {
+				serve(t, rl, newTestRequest("GET", "http://"+host+"/", nil), respond(200, "", "ok"))
+			}
+
+			var logged []string
+			for _, entry := range entries(t, mr, "access") {
+				logged = append([]string{entry["request"].(map[string]any)["host"].(string)}, logged...)
+			}
+			if !reflect.DeepEqual(logged, tc.want) {
+				t.Errorf("logged hosts %v, want %v", logged, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package redislogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+)
+
+// 支持的序列化格式
+const (
+	formatJSON    = "json"
+	formatMsgpack = "msgpack"
+	formatLogfmt  = "logfmt"
+	formatCEF     = "cef"
+)
+
+// validateFormat 检查 Format 配置是否合法
+func validateFormat(format string) error {
+	switch format {
+	case "", formatJSON, formatMsgpack, formatLogfmt, formatCEF:
+		return nil
+	default:
+		return fmt.Errorf("unsupported format '%s', expected json, msgpack, logfmt or cef", format)
+	}
+}
+
+// serialize 把日志序列化为写入列表的值：超过 MaxEntryBytes 时按 OversizePolicy 处理，
+// 再按需压缩。日志被丢弃时返回nil。
+func (rl *RedisLogger) serialize(record *accessEntry, elapsed time.Duration) ([]byte, error) {
+	var entry map[string]interface{}
+	var data []byte
+	var err error
+	if rl.fastPath {
+		data, err = record.marshalJSON()
+	} else {
+		entry = rl.entryMap(record)
+		data, err = rl.encode(entry, elapsed)
+	}
+	if err != nil {
+		rl.logger.Error("Error marshaling log entry", zap.Error(err))
+		return nil, err
+	}
+
+	// 开启 MaxEntryBytes 时不会走 fastPath，entry 一定不为nil
+	if rl.MaxEntryBytes > 0 && len(data) > rl.MaxEntryBytes {
+		size := len(data)
+		if data, err = rl.shrinkEntry(entry, elapsed); err != nil {
+			rl.logger.Error("Error marshaling log entry", zap.Error(err))
+			return nil, err
+		}
+		if data == nil {
+			rl.metrics.drop(dropReasonOversize)
+			rl.logger.Warn("Dropping oversized log entry",
+				zap.Int("size", size),
+				zap.Int("max_entry_bytes", rl.MaxEntryBytes),
+			)
+			return nil, nil
+		}
+	}
+
+	if data, err = rl.maybeCompress(data); err != nil {
+		rl.logger.Error("Error compressing log entry", zap.Error(err))
+		return nil, err
+	}
+	return data, nil
+}
+
+// transform 对原始日志做字段筛选、结构转换与重命名
+func (rl *RedisLogger) transform(entry map[string]interface{}, elapsed time.Duration) map[string]interface{} {
+	rl.selectFields(entry)
+	if rl.OutputSchema == schemaECS {
+		entry = ecsEntry(entry, elapsed)
+	}
+	return rl.renameFields(entry, "")
+}
+
+// encode 转换日志后按 Format 序列化
+func (rl *RedisLogger) encode(entry map[string]interface{}, elapsed time.Duration) ([]byte, error) {
+	return rl.marshal(rl.envelope(rl.transform(entry, elapsed)))
+}
+
+// validateEnvelope 检查信封配置：只有JSON与msgpack能表达嵌套的 payload，
+// hash 与 stream_fields 模式按字段写入，也不支持信封
+func (rl *RedisLogger) validateEnvelope() error {
+	if rl.EnvelopeType == "" {
+		if rl.EnvelopeVersion != 0 {
+			return fmt.Errorf("envelope_version requires envelope_type")
+		}
+		return nil
+	}
+	if rl.Format == formatLogfmt || rl.Format == formatCEF {
+		return fmt.Errorf("envelope_type requires format json or msgpack")
+	}
+	if rl.OutputMode == outputHash || rl.StreamFields {
+		return fmt.Errorf("envelope_type cannot be used with output_mode hash or stream_fields")
+	}
+	return nil
+}
+
+// envelope 按 EnvelopeType 把日志包装到信封的 payload 中，未配置时原样返回
+func (rl *RedisLogger) envelope(entry map[string]interface{}) map[string]interface{} {
+	if rl.EnvelopeType == "" {
+		return entry
+	}
+	return map[string]interface{}{
+		"type":    rl.EnvelopeType,
+		"version": rl.EnvelopeVersion,
+		"payload": entry,
+	}
+}
+
+// 超过 MaxEntryBytes 时的处理策略
+const (
+	oversizeTruncate = "truncate" // 依次去掉体积大的字段，并标记 truncated
+	oversizeDrop     = "drop"     // 直接丢弃
+)
+
+// validateOversizePolicy 检查 OversizePolicy 配置是否合法
+func validateOversizePolicy(policy string) error {
+	switch policy {
+	case "", oversizeTruncate, oversizeDrop:
+		return nil
+	default:
+		return fmt.Errorf("unsupported oversize_policy '%s', expected truncate or drop", policy)
+	}
+}
+
+// oversizeFields 是截断时依次去掉的字段，按通常的体积从大到小排列
+var oversizeFields = [][]string{
+	{"request_body"},
+	{"response_body"},
+	{"request", "headers"},
+	{"resp_headers"},
+}
+
+// shrinkEntry 处理超过 MaxEntryBytes 的日志：truncate 策略下依次去掉 oversizeFields
+// 并重新序列化，直到不超过上限；drop 策略或去掉这些字段后仍然超长时返回nil
+func (rl *RedisLogger) shrinkEntry(entry map[string]interface{}, elapsed time.Duration) ([]byte, error) {
+	if rl.OversizePolicy == oversizeDrop {
+		return nil, nil
+	}
+	entry["truncated"] = true
+	for _, path := range oversizeFields {
+		parent := entry
+		for _, key := range path[:len(path)-1] {
+			nested, ok := parent[key].(map[string]interface{})
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = nested
+		}
+		if parent == nil {
+			continue
+		}
+		if _, ok := parent[path[len(path)-1]]; !ok {
+			continue
+		}
+		delete(parent, path[len(path)-1])
+
+		data, err := rl.encode(entry, elapsed)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= rl.MaxEntryBytes {
+			return data, nil
+		}
+	}
+	return nil, nil
+}
+
+// marshal 按 Format 序列化日志，默认JSON
+func (rl *RedisLogger) marshal(entry map[string]interface{}) ([]byte, error) {
+	switch rl.Format {
+	case formatMsgpack:
+		return msgpack.Marshal(entry)
+	case formatLogfmt:
+		return marshalLogfmt(entry), nil
+	case formatCEF:
+		return marshalCEF(entry), nil
+	default:
+		return json.Marshal(entry)
+	}
+}
@@ -0,0 +1,140 @@
+package redislogger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMsgpackFormat(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Format = formatMsgpack
+	})
+	serve(t, rl, newTestRequest("POST", "/items", nil), respond(201, "", "ok"))
+
+	values, _ := mr.List("access")
+	if len(values) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(values))
+	}
+	var entry map[string]interface{}
+	if err := msgpack.Unmarshal([]byte(values[0]), &entry); err != nil {
+		t.Fatalf("entry is not msgpack: %v", err)
+	}
+	request := entry["request"].(map[string]interface{})
+	if request["method"] != "POST" || fmt.Sprint(entry["status"]) != "201" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{"", formatJSON, formatMsgpack, formatLogfmt, formatCEF} {
+		if err := validateFormat(format); err != nil {
+			t.Errorf("validateFormat(%q): %v", format, err)
+		}
+	}
+	if err := validateFormat("xml"); err == nil {
+		t.Error("expected xml to be rejected")
+	}
+}
+
+func TestMaxEntryBytes(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+
+	t.Run("truncate", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.WithResponseBody = true
+			rl.MaxEntryBytes = 2048
+		})
+		serve(t, rl, newTestRequest("GET", "/big", nil), respond(200, "", body))
+
+		values, _ := mr.List("access")
+		if len(values) != 1 || len(values[0]) > 2048 {
+			t.Fatalf("expected one entry within 2048 bytes, got %d entries", len(values))
+		}
+		entry := lastEntry(t, mr, "access")
+		if entry["truncated"] != true {
+			t.Errorf("missing truncated marker in %v", entry)
+		}
+		if _, ok := entry["response_body"]; ok {
+			t.Error("response_body should be removed from a truncated entry")
+		}
+		// 只去掉需要去掉的字段
+		if entry["request"].(map[string]any)["headers"] == nil || entry["status"] != float64(200) {
+			t.Errorf("truncation removed more than needed: %v", entry)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.WithResponseBody = true
+			rl.MaxEntryBytes = 2048
+			rl.OversizePolicy = oversizeDrop
+		})
+		serve(t, rl, newTestRequest("GET", "/small", nil), respond(200, "", "ok"))
+		serve(t, rl, newTestRequest("GET", "/big", nil), respond(200, "", body))
+
+		if uri := lastEntry(t, mr, "access")["request"].(map[string]any)["uri"]; uri != "/small" {
+			t.Errorf("expected only /small to be logged, got %v", uri)
+		}
+		if dropped := rl.metrics.droppedTotal.Load(); dropped != 1 {
+			t.Errorf("dropped = %d, want 1", dropped)
+		}
+	})
+
+	t.Run("still too large", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.MaxEntryBytes = 50
+		})
+		// 去掉所有可去掉的字段后仍然超长时丢弃
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+		if n := listLen(mr, "access"); n != 0 {
+			t.Errorf("expected the entry to be dropped, got %d", n)
+		}
+	})
+
+	if err := validateOversizePolicy("split"); err == nil {
+		t.Error("expected an unknown oversize_policy to be rejected")
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.EnvelopeType = "caddy.access"
+		rl.EnvelopeVersion = 2
+	})
+	serve(t, rl, newTestRequest("POST", "/items", nil), respond(201, "", "ok"))
+
+	// 信封只有 type、version 与 payload，日志原样放在 payload 中
+	envelope := lastEntry(t, mr, "access")
+	if len(envelope) != 3 || envelope["type"] != "caddy.access" || envelope["version"] != float64(2) {
+		t.Fatalf("unexpected envelope %v", envelope)
+	}
+	payload, ok := envelope["payload"].(map[string]any)
+	if !ok {
+		t.Fatalf("payload = %v", envelope["payload"])
+	}
+	request := payload["request"].(map[string]any)
+	if request["method"] != "POST" || request["uri"] != "/items" || payload["status"] != float64(201) || payload["ts"] == nil {
+		t.Errorf("unexpected payload %v", payload)
+	}
+
+	for name, configure := range map[string]func(rl *RedisLogger){
+		"version without type": func(rl *RedisLogger) { rl.EnvelopeVersion = 1 },
+		"logfmt":               func(rl *RedisLogger) { rl.EnvelopeType, rl.Format = "caddy.access", formatLogfmt },
+		"hash output":          func(rl *RedisLogger) { rl.EnvelopeType, rl.OutputMode = "caddy.access", outputHash },
+	} {
+		rl := &RedisLogger{RedisKey: "access", RedisAddress: mr.Addr()}
+		configure(rl)
+		if err := provision(t, rl); err == nil {
+			t.Errorf("%s: expected the envelope config to be rejected", name)
+		}
+	}
+}
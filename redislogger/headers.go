@@ -0,0 +1,59 @@
+package redislogger
+
+import (
+	"net/http"
+	"sort"
+)
+
+// headerSet 把配置的header名称规范化后放入集合，匹配时不区分大小写
+func headerSet(names []string) map[string]struct{} {
+	if len(names) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+	return set
+}
+
+// filterHeaders 按 HeaderInclude/HeaderExclude 过滤要记录的请求头。
+// 两者都配置时先取 include 再去掉 exclude；都未配置时原样返回。
+func (rl *RedisLogger) filterHeaders(header http.Header) http.Header {
+	if rl.headerInclude == nil && rl.headerExclude == nil {
+		return header
+	}
+
+	filtered := make(http.Header, len(header))
+	for name, values := range header {
+		key := http.CanonicalHeaderKey(name)
+		if rl.headerInclude != nil {
+			if _, ok := rl.headerInclude[key]; !ok {
+				continue
+			}
+		}
+		if _, ok := rl.headerExclude[key]; ok {
+			continue
+		}
+		filtered[name] = values
+	}
+	return filtered
+}
+
+// limitHeaders 只保留按名称排序后的前 MaxHeaders 个header，返回是否被截断
+func (rl *RedisLogger) limitHeaders(header http.Header) (http.Header, bool) {
+	if rl.MaxHeaders <= 0 || len(header) <= rl.MaxHeaders {
+		return header, false
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	limited := make(http.Header, rl.MaxHeaders)
+	for _, name := range names[:rl.MaxHeaders] {
+		limited[name] = header[name]
+	}
+	return limited, true
+}
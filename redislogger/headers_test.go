@@ -0,0 +1,160 @@
+package redislogger
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestFilterHeaders(t *testing.T) {
+	header := http.Header{
+		"User-Agent":    {"curl"},
+		"Accept":        {"*/*"},
+		"X-Debug":       {"1"},
+		"Authorization": {"Bearer x"},
+	}
+	for _, tc := range []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"none", nil, nil, []string{"Accept", "Authorization", "User-Agent", "X-Debug"}},
+		{"include", []string{"user-agent", "accept"}, nil, []string{"Accept", "User-Agent"}},
+		{"exclude", nil, []string{"x-debug"}, []string{"Accept", "Authorization", "User-Agent"}},
+		{"exclude wins", []string{"User-Agent", "X-Debug"}, []string{"X-DEBUG"}, []string{"User-Agent"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rl := &RedisLogger{headerInclude: headerSet(tc.include), headerExclude: headerSet(tc.exclude)}
+			got := rl.filterHeaders(header)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			for _, name := range tc.want {
+				if _, ok := got[name]; !ok {
+					t.Errorf("missing %s in %v", name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderIncludeInEntry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.HeaderInclude = []string{"user-agent"}
+	})
+
+	r := newTestRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "curl/8")
+	r.Header.Set("Cookie", "session=secret")
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	headers := lastEntry(t, mr, "access")["request"].(map[string]any)["headers"].(map[string]any)
+	if len(headers) != 1 || headers["User-Agent"] == nil {
+		t.Errorf("expected only User-Agent, got %v", headers)
+	}
+}
+
+func TestGeoHeaders(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger access {
+		geo_headers {
+			CF-IPCountry country
+			X-Geo-City city
+		}
+	}`)
+	mr := miniredis.RunT(t)
+	rl.RedisAddress = mr.Addr()
+	if err := provision(t, rl); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRequest("GET", "/geo", nil)
+	r.Header.Set("CF-IPCountry", "NL")
+	r.Header.Set("X-Geo-City", "Amsterdam")
+	serve(t, rl, r, respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/nogeo", nil), respond(200, "", "ok"))
+
+	got := entries(t, mr, "access")
+	// 没有映射的请求头时省略 geo
+	if geo, ok := got[0]["geo"]; ok {
+		t.Errorf("unexpected geo %v without geo headers", geo)
+	}
+	want := map[string]any{"country": "NL", "city": "Amsterdam"}
+	if !reflect.DeepEqual(got[1]["geo"], want) {
+		t.Errorf("geo = %v, want %v", got[1]["geo"], want)
+	}
+}
+
+func TestSanitizeControlChars(t *testing.T) {
+	const injected = "evil\r\nX-Forged: 1\x00"
+	handler := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("X-Upstream", injected)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	})
+	for _, sanitize := range []bool{false, true} {
+		mr := miniredis.RunT(t)
+		rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.SanitizeControlChars = sanitize
+		})
+		r := newTestRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", injected)
+		serve(t, rl, r, handler)
+
+		// 开启后控制字符转义为可见的 \r、\n、\xNN，原始请求头不受影响
+		want := injected
+		if sanitize {
+			want = `evil\r\nX-Forged: 1\x00`
+		}
+		entry := lastEntry(t, mr, "access")
+		ua := entry["request"].(map[string]any)["headers"].(map[string]any)["User-Agent"].([]any)[0]
+		upstream := entry["resp_headers"].(map[string]any)["X-Upstream"].([]any)[0]
+		if ua != want || upstream != want {
+			t.Errorf("sanitize=%v: User-Agent = %q, X-Upstream = %q, want %q", sanitize, ua, upstream, want)
+		}
+		if r.Header.Get("User-Agent") != injected {
+			t.Errorf("sanitize=%v modified the request header", sanitize)
+		}
+	}
+}
+
+func TestMaxHeaders(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.MaxHeaders = 3
+	})
+
+	r := newTestRequest("GET", "/", nil)
+	r.Header = http.Header{}
+	for _, name := range []string{"X-E", "X-A", "X-D", "X-B", "X-C"} {
+		r.Header.Set(name, "1")
+	}
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	// 按名称排序取前 max_headers 个
+	entry := lastEntry(t, mr, "access")
+	var names []string
+	for name := range entry["request"].(map[string]any)["headers"].(map[string]any) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"X-A", "X-B", "X-C"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("logged headers %v, want %v", names, want)
+	}
+	if entry["headers_truncated"] != true {
+		t.Errorf("headers_truncated = %v, want true", entry["headers_truncated"])
+	}
+
+	// 没有超出时不带标记
+	mr.Del("access")
+	r = newTestRequest("GET", "/", nil)
+	r.Header = http.Header{"X-A": {"1"}}
+	serve(t, rl, r, respond(200, "", "ok"))
+	if _, ok := lastEntry(t, mr, "access")["headers_truncated"]; ok {
+		t.Error("headers_truncated set without truncation")
+	}
+}
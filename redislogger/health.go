@@ -0,0 +1,194 @@
+package redislogger
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// 健康检查的默认参数
+const (
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckFailures = 3
+)
+
+// 启动时重试PING的默认参数
+const (
+	defaultStartupRetryInterval = time.Second
+	maxStartupRetryInterval     = 30 * time.Second
+)
+
+// liveClient 持有当前使用的Redis客户端，健康检查重建连接时原子地替换
+type liveClient struct {
+	mu      sync.RWMutex
+	client  redisClient
+	poolKey string // client 来自 clientPool 时为共享池中的key
+
+	stop chan struct{}
+	done chan struct{}
+
+	// 最近一次PING的时间与结果
+	pingAt  time.Time
+	pingErr error
+}
+
+// get 返回当前的客户端
+func (lc *liveClient) get() redisClient {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return lc.client
+}
+
+// swap 替换为本实例独占的客户端，并释放旧的客户端。
+// 旧客户端是共享的时只减少引用计数，其他实例仍然可以继续使用。
+func (lc *liveClient) swap(client redisClient) error {
+	lc.mu.Lock()
+	old, oldKey := lc.client, lc.poolKey
+	lc.client, lc.poolKey = client, ""
+	lc.mu.Unlock()
+	if old == nil {
+		return nil
+	}
+	return releaseClient(old, oldKey)
+}
+
+// close 释放当前的客户端
+func (lc *liveClient) close() error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return releaseClient(lc.client, lc.poolKey)
+}
+
+// recordPing 记录一次PING的结果
+func (lc *liveClient) recordPing(err error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.pingAt = time.Now()
+	lc.pingErr = err
+}
+
+// lastPing 返回最近一次PING的时间与结果
+func (lc *liveClient) lastPing() (time.Time, error) {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return lc.pingAt, lc.pingErr
+}
+
+// startHealthCheck 启动后台健康检查协程，HealthCheckInterval 为负数时不启动
+func (rl *RedisLogger) startHealthCheck() {
+	if rl.HealthCheckInterval < 0 {
+		return
+	}
+	if rl.HealthCheckInterval == 0 {
+		rl.HealthCheckInterval = caddy.Duration(defaultHealthCheckInterval)
+	}
+	if rl.HealthCheckFailures <= 0 {
+		rl.HealthCheckFailures = defaultHealthCheckFailures
+	}
+
+	rl.client.stop = make(chan struct{})
+	rl.client.done = make(chan struct{})
+	go rl.runHealthCheck()
+}
+
+// runHealthCheck 定期PING Redis，连续失败 HealthCheckFailures 次后重建客户端
+func (rl *RedisLogger) runHealthCheck() {
+	defer close(rl.client.done)
+
+	ticker := time.NewTicker(time.Duration(rl.HealthCheckInterval))
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-rl.client.stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := rl.ping(context.Background(), rl.client.get())
+		rl.client.recordPing(err)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		rl.logger.Warn("Redis health check failed",
+			zap.Int("consecutive_failures", failures),
+			zap.Error(err),
+		)
+		if failures < rl.HealthCheckFailures {
+			continue
+		}
+
+		if err := rl.reconnect(); err != nil {
+			rl.logger.Error("Error reconnecting to Redis", zap.Error(err))
+			continue
+		}
+		rl.client.recordPing(nil)
+		failures = 0
+		rl.logger.Info("Reconnected to Redis")
+	}
+}
+
+// reconnect 用相同的配置新建客户端，PING 成功后替换旧客户端
+func (rl *RedisLogger) reconnect() error {
+	client, err := rl.newClient()
+	if err != nil {
+		return err
+	}
+	if err := rl.ping(context.Background(), client); err != nil {
+		client.Close()
+		return err
+	}
+	if err := rl.client.swap(client); err != nil {
+		rl.logger.Warn("Error closing previous Redis client", zap.Error(err))
+	}
+	return nil
+}
+
+// waitForRedis 在 Provision 中检查Redis是否可用，失败后按 StartupRetries 重试，
+// 等待时间从 StartupRetryInterval 开始翻倍，最长30s。每次PING最多等待 DialTimeout，
+// 地址不可达时不会卡住配置加载；配置被卸载时提前返回。
+func (rl *RedisLogger) waitForRedis(ctx context.Context, client redisClient) error {
+	if rl.StartupRetryInterval <= 0 {
+		rl.StartupRetryInterval = caddy.Duration(defaultStartupRetryInterval)
+	}
+	wait := time.Duration(rl.StartupRetryInterval)
+
+	err := rl.ping(ctx, client)
+	for attempt := 1; err != nil && attempt <= rl.StartupRetries; attempt++ {
+		rl.logger.Warn("Redis not reachable, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("wait", wait),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxStartupRetryInterval)
+		err = rl.ping(ctx, client)
+	}
+	return err
+}
+
+// ping 在 DialTimeout 内检查连接是否可用，ctx 被取消时提前返回
+func (rl *RedisLogger) ping(ctx context.Context, client redisClient) error {
+	ctx, cancel := context.WithTimeout(ctx, rl.DialTimeout)
+	defer cancel()
+	return client.Ping(ctx).Err()
+}
+
+// stopHealthCheck 停止健康检查协程
+func (lc *liveClient) stopHealthCheck() {
+	if lc.stop == nil {
+		return
+	}
+	close(lc.stop)
+	<-lc.done
+}
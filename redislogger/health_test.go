@@ -0,0 +1,151 @@
+package redislogger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestHealthCheckReconnects(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.HealthCheckInterval = caddy.Duration(10 * time.Millisecond)
+		rl.HealthCheckFailures = 2
+	})
+	serve(t, rl, newTestRequest("GET", "/before", nil), respond(200, "", "ok"))
+
+	// 关闭当前客户端模拟连接失效，之后的写入都会失败，直到健康检查重建客户端
+	broken := rl.client.get()
+	broken.Close()
+	waitFor(t, "the health check to replace the client", func() bool { return rl.client.get() != broken })
+
+	serve(t, rl, newTestRequest("GET", "/after", nil), respond(200, "", "ok"))
+	got := entries(t, mr, "access")
+	if len(got) != 2 || got[0]["request"].(map[string]any)["uri"] != "/after" {
+		t.Errorf("pushes did not resume after reconnecting: %v", got)
+	}
+	if _, err := rl.client.lastPing(); err != nil {
+		t.Errorf("last ping after reconnecting = %v, want nil", err)
+	}
+}
+
+func TestHealthCheckKeepsClientWhileDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.HealthCheckInterval = caddy.Duration(10 * time.Millisecond)
+		rl.HealthCheckFailures = 1
+	})
+	client := rl.client.get()
+
+	// Redis不可用时重建的客户端PING不通，不会替换当前客户端
+	mr.Close()
+	waitFor(t, "a failed health check", func() bool {
+		_, err := rl.client.lastPing()
+		return err != nil
+	})
+	time.Sleep(50 * time.Millisecond)
+	if rl.client.get() != client {
+		t.Error("client replaced while Redis was unreachable")
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a successful health check", func() bool {
+		_, err := rl.client.lastPing()
+		return err == nil
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	lastEntry(t, mr, "access")
+}
+
+func TestProvisionDialTimeout(t *testing.T) {
+	// 10.255.255.1 不可路由，连接会一直挂起直到超时
+	rl := &RedisLogger{
+		RedisKey:     "access",
+		RedisAddress: "10.255.255.1:6379",
+		DialTimeout:  200 * time.Millisecond,
+	}
+	start := time.Now()
+	err := provision(t, rl)
+	elapsed := time.Since(start)
+	if err == nil {
+		t.Fatal("expected Provision to fail against an unreachable address")
+	}
+	// go-redis 的 MaxRetries 重试也受 dial_timeout 限制，配置加载不会被拖住
+	if elapsed > time.Second {
+		t.Errorf("Provision took %v to fail, want about the 200ms dial_timeout", elapsed)
+	}
+}
+
+func TestStartupRetries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	// Redis在第二次重试前启动，Provision 应该成功
+	restarted := make(chan error, 1)
+	time.AfterFunc(60*time.Millisecond, func() { restarted <- mr.Restart() })
+	rl := &RedisLogger{
+		RedisKey:             "access",
+		RedisAddress:         addr,
+		StartupRetries:       5,
+		StartupRetryInterval: caddy.Duration(50 * time.Millisecond),
+	}
+	if err := provision(t, rl); err != nil {
+		t.Fatalf("Provision did not retry until Redis was up: %v", err)
+	}
+	if err := <-restarted; err != nil {
+		t.Fatal(err)
+	}
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if n := listLen(mr, "access"); n != 1 {
+		t.Errorf("expected 1 entry after startup, got %d", n)
+	}
+
+	// 重试用完后仍连不上时配置加载失败
+	mr.Close()
+	rl = &RedisLogger{
+		RedisKey:             "access",
+		RedisAddress:         addr,
+		StartupRetries:       2,
+		StartupRetryInterval: caddy.Duration(10 * time.Millisecond),
+	}
+	if err := provision(t, rl); err == nil {
+		t.Error("expected Provision to fail once the retries are used up")
+	}
+}
+
+func TestSoftStart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	rl := &RedisLogger{
+		RedisKey:            "access",
+		RedisAddress:        addr,
+		SoftStart:           true,
+		HealthCheckInterval: caddy.Duration(10 * time.Millisecond),
+	}
+	if err := provision(t, rl); err != nil {
+		t.Fatalf("soft_start should tolerate an unreachable Redis: %v", err)
+	}
+	if _, err := rl.client.lastPing(); err == nil {
+		t.Error("the failed startup ping was not recorded")
+	}
+
+	// Redis启动后后台健康检查恢复连接，写入正常进行
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the health check to reach Redis", func() bool {
+		_, err := rl.client.lastPing()
+		return err == nil
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if n := listLen(mr, "access"); n != 1 {
+		t.Errorf("expected 1 entry once Redis is up, got %d", n)
+	}
+}
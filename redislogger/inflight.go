@@ -0,0 +1,56 @@
+package redislogger
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 同时进行的写入达到 MaxInFlight 时的处理方式
+const (
+	fullPolicyDrop = "drop" // 直接丢弃并计数（默认）
+	fullPolicyWait = "wait" // 最多等待 InFlightWait，超时后丢弃
+)
+
+// 未配置 InFlightWait 时 wait 策略的最长等待时间
+const defaultInFlightWait = time.Second
+
+// validateFullPolicy 检查 FullPolicy 配置是否合法
+func validateFullPolicy(policy string) error {
+	switch policy {
+	case "", fullPolicyDrop, fullPolicyWait:
+		return nil
+	default:
+		return fmt.Errorf("unsupported full_policy '%s', expected drop or wait", policy)
+	}
+}
+
+// acquireInFlight 占用一个写入名额，未配置 MaxInFlight 时总是成功。
+// 名额已满时按 FullPolicy 丢弃或等待；没有拿到名额时丢弃这些日志并计数。
+func (rl *RedisLogger) acquireInFlight(items []logItem) (release func(), ok bool) {
+	if rl.inFlight == nil {
+		return func() {}, true
+	}
+	select {
+	case rl.inFlight <- struct{}{}:
+		return func() { <-rl.inFlight }, true
+	default:
+	}
+
+	if rl.FullPolicy == fullPolicyWait {
+		timer := time.NewTimer(time.Duration(rl.InFlightWait))
+		defer timer.Stop()
+		select {
+		case rl.inFlight <- struct{}{}:
+			return func() { <-rl.inFlight }, true
+		case <-timer.C:
+		}
+	}
+
+	for _, item := range items {
+		rl.metrics.drop(dropReasonInFlightFull)
+		rl.logger.Debug("Too many pushes in flight, dropping entry", zap.String("key", item.key))
+	}
+	return nil, false
+}
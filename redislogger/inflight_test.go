@@ -0,0 +1,119 @@
+package redislogger
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// gatedClient 的每次写入先通知 started，再阻塞到 release 关闭，用于占住写入名额
+type gatedClient struct {
+	redisClient
+	started chan struct{}
+	release chan struct{}
+}
+
+func (gc gatedClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	gc.started <- struct{}{}
+	<-gc.release
+	return gc.redisClient.Pipelined(ctx, fn)
+}
+
+// saturate 把 rl 的客户端换成 gatedClient，并发起 MaxInFlight 个请求占满名额，
+// 返回放行这些写入并等待它们结束的函数
+func saturate(t *testing.T, rl *RedisLogger) (releaseAll func()) {
+	t.Helper()
+	gc := gatedClient{redisClient: rl.client.get(), started: make(chan struct{}, 16), release: make(chan struct{})}
+	rl.client.mu.Lock()
+	rl.client.client = gc
+	rl.client.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < rl.MaxInFlight; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+		}()
+		<-gc.started
+	}
+	return func() {
+		close(gc.release)
+		wg.Wait()
+	}
+}
+
+// inFlightDrops 返回 rl 的 in_flight_full 丢弃数，计数器在进程内共享，测试比较前后的差值
+func inFlightDrops(rl *RedisLogger) float64 {
+	return testutil.ToFloat64(rl.metrics.dropped.WithLabelValues(dropReasonInFlightFull))
+}
+
+func TestInFlightDrop(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "inflight_drop"
+		rl.MaxInFlight = 2
+	})
+	releaseAll := saturate(t, rl)
+	before := inFlightDrops(rl)
+
+	// 名额已满时立即丢弃，不等待
+	start := time.Now()
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("drop policy blocked for %v", elapsed)
+	}
+	if got := inFlightDrops(rl) - before; got != 1 {
+		t.Errorf("entries_dropped_total{reason=in_flight_full} = %v, want 1", got)
+	}
+
+	releaseAll()
+	if n := listLen(mr, "inflight_drop"); n != 2 {
+		t.Errorf("got %d entries, want the 2 in-flight pushes", n)
+	}
+}
+
+func TestInFlightWait(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "inflight_wait"
+		rl.MaxInFlight = 2
+		rl.FullPolicy = fullPolicyWait
+		rl.InFlightWait = caddy.Duration(200 * time.Millisecond)
+	})
+	releaseAll := saturate(t, rl)
+	before := inFlightDrops(rl)
+
+	// 等满 in_flight_wait 仍没有名额时丢弃
+	start := time.Now()
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("wait policy gave up after %v, want at least in_flight_wait", elapsed)
+	}
+	if got := inFlightDrops(rl) - before; got != 1 {
+		t.Errorf("entries_dropped_total{reason=in_flight_full} = %v, want 1", got)
+	}
+
+	// 等待期间有名额释放时照常写入
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	releaseAll()
+	<-done
+	if got := inFlightDrops(rl) - before; got != 1 {
+		t.Errorf("entries_dropped_total{reason=in_flight_full} = %v after a slot was freed, want 1", got)
+	}
+	if n := listLen(mr, "inflight_wait"); n != 3 {
+		t.Errorf("got %d entries, want 3", n)
+	}
+}
@@ -0,0 +1,139 @@
+package redislogger
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// redisKeys 返回本次请求要写入的key，第一个是 RedisKey，其后是 RedisKeys。
+// key 中可以使用占位符，例如 logs:{http.request.host} 或
+// access:{http.response.status}；都不含占位符时直接返回，避免每个请求都做替换。
+// 开启 ShardByMethod 时在每个key后追加 :<method>，如 logs:GET、logs:POST；
+// 最后在前面加上 KeyPrefix，如 prod:logs:GET。
+// 展开为空的key会被跳过，全部为空时返回空切片。
+func (rl *RedisLogger) redisKeys(r *http.Request, status int) []string {
+	keys := rl.expandKeys(r, status)
+	if !rl.ShardByMethod && rl.KeyPrefix == "" {
+		return keys
+	}
+	// 未展开时 keys 就是 rl.keys，不能原地修改
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		if rl.ShardByMethod {
+			key += ":" + r.Method
+		}
+		out[i] = rl.KeyPrefix + key
+	}
+	return out
+}
+
+// expandKeys 展开key中的时间格式与占位符
+func (rl *RedisLogger) expandKeys(r *http.Request, status int) []string {
+	if !rl.keyHasPlaceholders && rl.timeKeys == nil {
+		return rl.keys
+	}
+
+	keys := make([]string, len(rl.keys))
+	copy(keys, rl.keys)
+	if rl.timeKeys != nil {
+		now := rl.now()
+		for i, tk := range rl.timeKeys {
+			if tk != nil {
+				keys[i] = tk.expand(now)
+			}
+		}
+	}
+	if !rl.keyHasPlaceholders {
+		return keys
+	}
+
+	// 请求的 replacer 由整条处理链共享，响应状态只在本地替换，不写回 replacer
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		repl = caddy.NewReplacer()
+	}
+	statusText := strconv.Itoa(status)
+	expanded := keys[:0]
+	for _, key := range keys {
+		key = strings.ReplaceAll(key, "{http.response.status}", statusText)
+		// 未知或缺失的占位符展开为空，不会把原始模板当作key写入
+		if key = repl.ReplaceAll(key, ""); key != "" {
+			expanded = append(expanded, key)
+		}
+	}
+	return expanded
+}
+
+// timeKey 展开key中 %Y-%m-%d 这样的时间格式，用于按天或按小时轮转key。
+// 同一秒内的结果会被缓存，避免每个请求都重新格式化。
+type timeKey struct {
+	template string
+
+	mu    sync.Mutex
+	sec   int64
+	value string
+}
+
+// expand 按本地时间展开时间格式
+func (tk *timeKey) expand(t time.Time) string {
+	sec := t.Unix()
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	if tk.value == "" || tk.sec != sec {
+		tk.sec = sec
+		tk.value = strftime(tk.template, t)
+	}
+	return tk.value
+}
+
+// strftimeVerbs 是支持的时间格式
+var strftimeVerbs = map[byte]func(t time.Time) string{
+	'Y': func(t time.Time) string { return strconv.Itoa(t.Year()) },
+	'y': func(t time.Time) string { return t.Format("06") },
+	'm': func(t time.Time) string { return t.Format("01") },
+	'd': func(t time.Time) string { return t.Format("02") },
+	'H': func(t time.Time) string { return t.Format("15") },
+	'M': func(t time.Time) string { return t.Format("04") },
+	'S': func(t time.Time) string { return t.Format("05") },
+	'j': func(t time.Time) string { return t.Format("002") },
+	'%': func(time.Time) string { return "%" },
+}
+
+// strftime 展开 %Y %y %m %d %H %M %S %j 与 %%，其余内容原样保留
+func strftime(template string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] == '%' && i+1 < len(template) {
+			if verb, ok := strftimeVerbs[template[i+1]]; ok {
+				b.WriteString(verb(t))
+				i++
+				continue
+			}
+		}
+		b.WriteByte(template[i])
+	}
+	return b.String()
+}
+
+// hasTimeVerbs 判断key中是否包含时间格式
+func hasTimeVerbs(s string) bool {
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] == '%' {
+			if _, ok := strftimeVerbs[s[i+1]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasPlaceholders 判断字符串中是否包含 {...} 占位符
+func hasPlaceholders(s string) bool {
+	open := strings.IndexByte(s, '{')
+	return open >= 0 && strings.IndexByte(s[open:], '}') > 0
+}
@@ -0,0 +1,211 @@
+package redislogger
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestKeyPlaceholders(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "logs:{http.request.host}:{http.response.status}"
+	})
+
+	r := newTestRequest("GET", "http://example.com/", nil)
+	serve(t, rl, r, respond(404, "", ""))
+	lastEntry(t, mr, "logs:example.com:404")
+
+	r = newTestRequest("GET", "http://other.test/", nil)
+	serve(t, rl, r, respond(200, "", "ok"))
+	lastEntry(t, mr, "logs:other.test:200")
+}
+
+func TestKeyEmptyExpansionSkipped(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "{http.request.header.X-Tenant}"
+		rl.RedisKeys = []string{"all"}
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	// 展开为空的key被跳过，不会把原始模板当作key写入
+	lastEntry(t, mr, "all")
+	if mr.Exists("{http.request.header.X-Tenant}") {
+		t.Error("the raw template was used as a key")
+	}
+}
+
+func TestKeyEmptyExpansionDropped(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "{http.request.header.X-Tenant}"
+	})
+	dropped := testutil.ToFloat64(rl.metrics.dropped.WithLabelValues(dropReasonEmptyKey))
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if got := testutil.ToFloat64(rl.metrics.dropped.WithLabelValues(dropReasonEmptyKey)) - dropped; got != 1 {
+		t.Errorf("expected 1 empty_key drop, got %v", got)
+	}
+	if keys := mr.Keys(); len(keys) != 0 {
+		t.Errorf("expected no keys, got %v", keys)
+	}
+}
+
+func TestKeyStatusLeavesReplacer(t *testing.T) {
+	rl := &RedisLogger{keys: []string{"access:{http.response.status}"}, keyHasPlaceholders: true}
+	r := newTestRequest("GET", "/", nil)
+	if keys := rl.redisKeys(r, 404); !reflect.DeepEqual(keys, []string{"access:404"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	// 请求共享的 replacer 中不应出现响应状态
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if v, ok := repl.Get("http.response.status"); ok {
+		t.Errorf("http.response.status was set on the request replacer: %v", v)
+	}
+}
+
+func TestKeyWithoutPlaceholdersNotCopied(t *testing.T) {
+	rl := &RedisLogger{keys: []string{"access"}}
+	keys := rl.redisKeys(newTestRequest("GET", "/", nil), 200)
+	if len(keys) != 1 || &keys[0] != &rl.keys[0] {
+		t.Errorf("expected the configured keys to be returned as is, got %v", keys)
+	}
+}
+
+func TestMultipleKeys(t *testing.T) {
+	rl := parseTestCaddyfile(t, `redis_logger debug {
+		redis_key archive
+		redis_key audit
+	}`)
+	if rl.RedisKey != "debug" || !reflect.DeepEqual(rl.RedisKeys, []string{"archive", "audit"}) {
+		t.Fatalf("unexpected keys %q %q", rl.RedisKey, rl.RedisKeys)
+	}
+
+	mr := miniredis.RunT(t)
+	rl.RedisAddress = mr.Addr()
+	if err := provision(t, rl); err != nil {
+		t.Fatal(err)
+	}
+	rc := recordPipelines(rl)
+	serve(t, rl, newTestRequest("GET", "/fanout", nil), respond(200, "", "ok"))
+
+	for _, key := range []string{"debug", "archive", "audit"} {
+		if uri := lastEntry(t, mr, key)["request"].(map[string]any)["uri"]; uri != "/fanout" {
+			t.Errorf("%s: uri = %v", key, uri)
+		}
+	}
+	// 所有key在同一个pipeline中写入
+	if calls := rc.calls(); len(calls) != 1 || len(calls[0]) != 3 {
+		t.Errorf("expected one pipeline with 3 pushes, got %v", calls)
+	}
+}
+
+func TestValidateRejectsEmptyKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, nil)
+	if err := rl.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	for _, tc := range []struct {
+		key  string
+		keys []string
+		want string
+	}{
+		{"", nil, "redis_key is required"},
+		{"  ", nil, "redis_key is required"},
+		{"access", []string{"archive", " "}, "redis_keys cannot contain an empty key"},
+	} {
+		rl.RedisKey, rl.RedisKeys = tc.key, tc.keys
+		if err := rl.Validate(); err == nil || err.Error() != tc.want {
+			t.Errorf("Validate with key %q, keys %q = %v, want %q", tc.key, tc.keys, err, tc.want)
+		}
+	}
+}
+
+func TestTimeKeyRotation(t *testing.T) {
+	mr := miniredis.RunT(t)
+	clock := time.Date(2024, 6, 1, 23, 59, 59, 500_000_000, time.UTC)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "logs:%Y-%m-%d"
+		rl.now = func() time.Time { return clock }
+	})
+
+	serve(t, rl, newTestRequest("GET", "/before", nil), respond(200, "", "ok"))
+	clock = clock.Add(time.Second)
+	serve(t, rl, newTestRequest("GET", "/after", nil), respond(200, "", "ok"))
+
+	for key, uri := range map[string]string{"logs:2024-06-01": "/before", "logs:2024-06-02": "/after"} {
+		if got := lastEntry(t, mr, key)["request"].(map[string]any)["uri"]; got != uri {
+			t.Errorf("%s: uri = %v, want %s", key, got, uri)
+		}
+	}
+}
+
+func TestStrftime(t *testing.T) {
+	at := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	if got, want := strftime("%Y %y %m %d %H %M %S %j %% %q", at), "2024 24 02 03 04 05 06 034 % %q"; got != want {
+		t.Errorf("strftime = %q, want %q", got, want)
+	}
+	for key, want := range map[string]bool{"logs:%Y": true, "logs:100%": false, "logs:%%": true, "logs": false} {
+		if got := hasTimeVerbs(key); got != want {
+			t.Errorf("hasTimeVerbs(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.KeyPrefix = "prod:"
+		rl.RedisKey = "logs"
+		rl.RedisKeys = []string{"archive"}
+		rl.ShardByMethod = true
+		rl.StatsKeyPrefix = "stats"
+		rl.UniqueIPKey = "unique_ips"
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+
+	// 前缀加在所有写入的key前面，包括分片后的key、统计key与去重IP的key
+	want := []string{
+		"prod:archive:GET",
+		"prod:logs:GET",
+		"prod:stats:method:GET",
+		"prod:stats:status:200",
+		"prod:unique_ips",
+	}
+	if keys := mr.Keys(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+	lastEntry(t, mr, "prod:logs:GET")
+	lastEntry(t, mr, "prod:archive:GET")
+}
+
+func TestShardByMethod(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "logs:{http.request.host}"
+		rl.RedisKeys = []string{"archive"}
+		rl.ShardByMethod = true
+	})
+	serve(t, rl, newTestRequest("GET", "http://example.com/", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("POST", "http://example.com/", nil), respond(201, "", "ok"))
+
+	// 方法追加在展开后的每个key之后
+	for _, key := range []string{"logs:example.com:GET", "archive:GET"} {
+		if method := lastEntry(t, mr, key)["request"].(map[string]any)["method"]; method != "GET" {
+			t.Errorf("%s: method = %v", key, method)
+		}
+	}
+	for _, key := range []string{"logs:example.com:POST", "archive:POST"} {
+		if method := lastEntry(t, mr, key)["request"].(map[string]any)["method"]; method != "POST" {
+			t.Errorf("%s: method = %v", key, method)
+		}
+	}
+	if mr.Exists("archive") || mr.Exists("logs:example.com") {
+		t.Error("entries were also written to the unsharded keys")
+	}
+}
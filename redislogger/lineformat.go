@@ -0,0 +1,193 @@
+package redislogger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flatten 把嵌套的日志展开为点分隔的key，如 request.method；
+// 切片与多值请求头用逗号连接
+func flatten(prefix string, value interface{}, out map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			flatten(join(key), nested, out)
+		}
+	case http.Header:
+		for key, values := range v {
+			out[join(key)] = strings.Join(values, ",")
+		}
+	case url.Values:
+		for key, values := range v {
+			out[join(key)] = strings.Join(values, ",")
+		}
+	case map[string]string:
+		for key, nested := range v {
+			out[join(key)] = nested
+		}
+	case []string:
+		out[prefix] = strings.Join(v, ",")
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		out[prefix] = strings.Join(parts, ",")
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
+
+// sortedKeys 返回排好序的key，保证输出稳定
+func sortedKeys(fields map[string]string) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// marshalLogfmt 把日志序列化为 logfmt：key=value 以空格分隔，
+// 值为空或包含空格、等号、引号及控制字符时加引号转义
+func marshalLogfmt(entry map[string]interface{}) []byte {
+	fields := make(map[string]string, len(entry))
+	flatten("", entry, fields)
+
+	var b strings.Builder
+	for i, key := range sortedKeys(fields) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(logfmtKey(key))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(fields[key]))
+	}
+	return []byte(b.String())
+}
+
+// logfmtKey 去掉key中不允许出现的空格、等号与引号
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue 按需给值加引号
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+// CEF头部中的设备信息
+const (
+	cefVendor  = "Caddy"
+	cefProduct = "redis_logger"
+	cefVersion = "1.0"
+)
+
+// cefExtensionKeys 把常用字段映射到CEF标准扩展字段，其余字段保留展开后的key
+var cefExtensionKeys = map[string]string{
+	"ts":                         "rt",
+	"request.remote_ip":          "src",
+	"request.remote_port":        "spt",
+	"request.client_ip":          "sourceTranslatedAddress",
+	"request.method":             "requestMethod",
+	"request.uri":                "request",
+	"request.host":               "dhost",
+	"request.proto":              "app",
+	"request.headers.User-Agent": "requestClientApplication",
+	"request.headers.Referer":    "requestContext",
+	"request.headers.Cookie":     "requestCookies",
+	"bytes_read":                 "in",
+	"size":                       "out",
+	"request.tls.server_name":    "destinationServiceName",
+	"upstream":                   "destinationTranslatedAddress",
+	"request_id":                 "externalId",
+	"server.name":                "deviceProcessName",
+}
+
+// marshalCEF 把日志序列化为一行 CEF（ArcSight Common Event Format）：
+//
+//	CEF:0|Caddy|redis_logger|1.0|<status>|<method> <uri>|<severity>|<extension>
+//
+// 严重程度按状态码取值：5xx 为7，4xx 为5，其余为1
+func marshalCEF(entry map[string]interface{}) []byte {
+	fields := make(map[string]string, len(entry))
+	flatten("", entry, fields)
+
+	status := fields["status"]
+	severity := "1"
+	switch {
+	case strings.HasPrefix(status, "5"):
+		severity = "7"
+	case strings.HasPrefix(status, "4"):
+		severity = "5"
+	}
+	name := strings.TrimSpace(fields["request.method"] + " " + fields["request.uri"])
+	if status == "" {
+		status = "-"
+	}
+	if name == "" {
+		name = "request"
+	}
+
+	var b strings.Builder
+	b.WriteString("CEF:0|")
+	for _, header := range []string{cefVendor, cefProduct, cefVersion, status, name, severity} {
+		b.WriteString(cefHeader(header))
+		b.WriteByte('|')
+	}
+
+	for i, key := range sortedKeys(fields) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if mapped, ok := cefExtensionKeys[key]; ok {
+			b.WriteString(mapped)
+		} else {
+			b.WriteString(logfmtKey(key))
+		}
+		b.WriteByte('=')
+		b.WriteString(cefExtension(fields[key]))
+	}
+	return []byte(b.String())
+}
+
+var (
+	cefHeaderReplacer    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// cefHeader 转义CEF头部字段中的反斜杠与竖线，头部不允许换行
+func cefHeader(s string) string {
+	return cefHeaderReplacer.Replace(s)
+}
+
+// cefExtension 转义CEF扩展字段值中的反斜杠、等号与换行
+func cefExtension(s string) string {
+	return cefExtensionReplacer.Replace(s)
+}
@@ -0,0 +1,68 @@
+package redislogger
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// knownEntry 返回包含需要转义的值的日志
+func knownEntry() map[string]interface{} {
+	return map[string]interface{}{
+		"ts":     "2024-06-01T12:00:00Z",
+		"status": 500,
+		"msg":    "",
+		"note":   "say \"hi\"\nbye",
+		"request": map[string]interface{}{
+			"method":  "GET",
+			"uri":     "/a b?x=1|2",
+			"headers": http.Header{"User-Agent": {"curl/8 x=y"}},
+		},
+	}
+}
+
+func TestMarshalLogfmt(t *testing.T) {
+	want := `msg="" note="say \"hi\"\nbye" request.headers.User-Agent="curl/8 x=y" request.method=GET request.uri="/a b?x=1|2" status=500 ts=2024-06-01T12:00:00Z`
+	if got := string(marshalLogfmt(knownEntry())); got != want {
+		t.Errorf("marshalLogfmt =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMarshalCEF(t *testing.T) {
+	want := `CEF:0|Caddy|redis_logger|1.0|500|GET /a b?x=1\|2|7|` +
+		`msg= note=say "hi"\nbye requestClientApplication=curl/8 x\=y requestMethod=GET request=/a b?x\=1|2 status=500 rt=2024-06-01T12:00:00Z`
+	if got := string(marshalCEF(knownEntry())); got != want {
+		t.Errorf("marshalCEF =\n%s\nwant\n%s", got, want)
+	}
+
+	// 没有状态码与请求时头部使用占位值，严重程度按状态码取值
+	if got := string(marshalCEF(map[string]interface{}{"msg": "x"})); !strings.HasPrefix(got, "CEF:0|Caddy|redis_logger|1.0|-|request|1|") {
+		t.Errorf("unexpected CEF header for an empty entry: %s", got)
+	}
+	if got := string(marshalCEF(map[string]interface{}{"status": 404})); !strings.Contains(got, "|404|request|5|") {
+		t.Errorf("unexpected CEF severity for a 404: %s", got)
+	}
+}
+
+func TestLineFormatPushed(t *testing.T) {
+	for _, format := range []string{formatLogfmt, formatCEF} {
+		t.Run(format, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.Format = format
+				rl.Fields = []string{"status", "request"}
+			})
+			serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+
+			values, _ := mr.List("access")
+			if len(values) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(values))
+			}
+			if !strings.Contains(values[0], "status=200") || strings.HasPrefix(values[0], "{") {
+				t.Errorf("unexpected %s line %q", format, values[0])
+			}
+		})
+	}
+}
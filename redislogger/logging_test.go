@@ -0,0 +1,50 @@
+package redislogger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestInstanceLoggerFields(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.LogName = "edge"
+		rl.WriteTimeout = 100 * time.Millisecond
+		rl.HealthCheckInterval = -1
+	})
+	// Provision使用Caddy的logger，这里换成observer，字段与名称仍由 instanceLogger 添加；
+	// 换好之后再启动健康检查协程
+	core, logs := observer.New(zap.WarnLevel)
+	rl.logger = rl.instanceLogger(zap.New(core))
+	rl.HealthCheckInterval = caddy.Duration(10 * time.Millisecond)
+	rl.HealthCheckFailures = 100
+	rl.startHealthCheck()
+
+	addr := mr.Addr()
+	mr.Close()
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	waitFor(t, "a failed health check", func() bool {
+		return logs.FilterMessage("Redis health check failed").Len() > 0
+	})
+
+	for _, msg := range []string{"Error pushing log entry to Redis", "Redis health check failed"} {
+		entries := logs.FilterMessage(msg).All()
+		if len(entries) == 0 {
+			t.Errorf("%q was not logged", msg)
+			continue
+		}
+		entry := entries[0]
+		if entry.LoggerName != "edge" {
+			t.Errorf("%q: logger name = %q, want edge", msg, entry.LoggerName)
+		}
+		fields := entry.ContextMap()
+		if fields["redis_key"] != "access" || fields["redis_address"] != addr {
+			t.Errorf("%q: missing instance fields in %v", msg, fields)
+		}
+	}
+}
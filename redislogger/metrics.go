@@ -0,0 +1,89 @@
+package redislogger
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// 与Caddy自带的HTTP指标一样注册到默认的prometheus registry，通过Caddy的 /metrics 暴露
+var redisLoggerMetrics = struct {
+	init          sync.Once
+	pushed        *prometheus.CounterVec
+	pushErrors    *prometheus.CounterVec
+	dropped       *prometheus.CounterVec
+	writeDuration *prometheus.HistogramVec
+}{}
+
+func initRedisLoggerMetrics() {
+	const ns, sub = "caddy", "redis_logger"
+
+	redisLoggerMetrics.pushed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Subsystem: sub,
+		Name:      "entries_pushed_total",
+		Help:      "Number of log entries successfully pushed to Redis.",
+	}, []string{"key"})
+	redisLoggerMetrics.pushErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Subsystem: sub,
+		Name:      "push_errors_total",
+		Help:      "Number of failed writes to Redis.",
+	}, []string{"key"})
+	redisLoggerMetrics.dropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: ns,
+		Subsystem: sub,
+		Name:      "entries_dropped_total",
+		Help:      "Number of log entries that were not pushed, by reason.",
+	}, []string{"key", "reason"})
+	redisLoggerMetrics.writeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: ns,
+		Subsystem: sub,
+		Name:      "write_duration_seconds",
+		Help:      "Latency of writes to Redis.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"key"})
+}
+
+// 日志被丢弃的原因
+const (
+	dropReasonSampled      = "sampled"
+	dropReasonBufferFull   = "buffer_full"
+	dropReasonSpillFull    = "spill_full"
+	dropReasonOversize     = "oversize"
+	dropReasonRateLimited  = "rate_limited"
+	dropReasonInFlightFull = "in_flight_full"
+	dropReasonEmptyKey     = "empty_key"
+)
+
+// loggerMetrics 是某个 redis_logger 实例的指标，key 标签取配置中的 RedisKey（未展开的模板），
+// 避免按请求展开后的key产生过多的时间序列
+type loggerMetrics struct {
+	pushed        prometheus.Counter
+	pushErrors    prometheus.Counter
+	dropped       *prometheus.CounterVec
+	writeDuration prometheus.Observer
+
+	// 本实例的累计值，供管理接口使用；prometheus的计数器按key共享，重载后也不清零
+	pushedTotal     atomic.Uint64
+	pushErrorsTotal atomic.Uint64
+	droppedTotal    atomic.Uint64
+}
+
+func newLoggerMetrics(key string) *loggerMetrics {
+	redisLoggerMetrics.init.Do(initRedisLoggerMetrics)
+	return &loggerMetrics{
+		pushed:        redisLoggerMetrics.pushed.WithLabelValues(key),
+		pushErrors:    redisLoggerMetrics.pushErrors.WithLabelValues(key),
+		dropped:       redisLoggerMetrics.dropped.MustCurryWith(prometheus.Labels{"key": key}),
+		writeDuration: redisLoggerMetrics.writeDuration.WithLabelValues(key),
+	}
+}
+
+// drop 记录一条被丢弃的日志
+func (m *loggerMetrics) drop(reason string) {
+	m.dropped.WithLabelValues(reason).Inc()
+	m.droppedTotal.Add(1)
+}
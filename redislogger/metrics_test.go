@@ -0,0 +1,44 @@
+package redislogger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	mr := miniredis.RunT(t)
+	// 指标按 redis_key 区分，用单独的key避免受其他测试影响
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "metrics_test"
+		rl.LogStatus = []string{"200-299"}
+		rl.WriteTimeout = 100 * time.Millisecond
+	})
+
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if got := testutil.ToFloat64(rl.metrics.pushed); got != 1 {
+		t.Errorf("entries_pushed_total = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(redisLoggerMetrics.writeDuration); got == 0 {
+		t.Error("write_duration_seconds has no observations")
+	}
+
+	rl.SampleRate = 0.0000001
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if got := testutil.ToFloat64(rl.metrics.dropped.WithLabelValues(dropReasonSampled)); got != 1 {
+		t.Errorf("entries_dropped_total{reason=sampled} = %v, want 1", got)
+	}
+	rl.SampleRate = 0
+
+	mr.Close()
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if got := testutil.ToFloat64(rl.metrics.pushErrors); got != 1 {
+		t.Errorf("push_errors_total = %v, want 1", got)
+	}
+	if rl.metrics.pushedTotal.Load() != 1 || rl.metrics.pushErrorsTotal.Load() != 1 || rl.metrics.droppedTotal.Load() != 1 {
+		t.Errorf("unexpected instance totals pushed=%d errors=%d dropped=%d",
+			rl.metrics.pushedTotal.Load(), rl.metrics.pushErrorsTotal.Load(), rl.metrics.droppedTotal.Load())
+	}
+}
@@ -0,0 +1,92 @@
+package redislogger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 日志写入Redis的方式
+const (
+	outputList   = "list"   // LPUSH 到列表（默认）
+	outputHash   = "hash"   // 以请求ID为key，HSET 展开后的字段
+	outputStream = "stream" // XADD 到stream，日志放在 data 字段中
+	outputZset   = "zset"   // ZADD 到有序集合，score 为日志时间的Unix微秒数
+)
+
+// hash 模式下未配置 KeyTTL 时的过期时间，避免每个请求一个key无限堆积
+const defaultHashTTL = 24 * time.Hour
+
+// validateOutputMode 检查 OutputMode 配置是否合法
+func validateOutputMode(mode string) error {
+	switch mode {
+	case "", outputList, outputHash, outputStream, outputZset:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output_mode '%s', expected list, hash, stream or zset", mode)
+	}
+}
+
+// validateZset 检查 zset 模式不能同时使用的配置：脚本只会写列表
+func (rl *RedisLogger) validateZset() error {
+	if rl.OutputMode == outputZset && rl.UseScript {
+		return fmt.Errorf("use_script cannot be used with output_mode zset")
+	}
+	return nil
+}
+
+// trimKey 在pipeline中把列表或有序集合裁到 MaxLen，只保留最新的日志。
+// 有序集合按 score 从小到大排列，去掉排名最靠前（最早）的成员。
+func (rl *RedisLogger) trimKey(ctx context.Context, pipe redis.Pipeliner, key string) {
+	if rl.OutputMode == outputZset {
+		pipe.ZRemRangeByRank(ctx, key, 0, -int64(rl.MaxLen)-1)
+		return
+	}
+	pipe.LTrim(ctx, key, 0, int64(rl.MaxLen-1))
+}
+
+// hashFields 把日志展开为 hash 的字段，嵌套字段用点连接，如 request.method
+func hashFields(entry map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(entry))
+	flatten("", entry, fields)
+	return fields
+}
+
+// hashArgs 把字段转为 HSET 的参数
+func hashArgs(fields map[string]string) []interface{} {
+	args := make([]interface{}, 0, len(fields)*2)
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	return args
+}
+
+// hashTTL 返回 hash 的过期时间，优先使用 KeyTTL
+func (rl *RedisLogger) hashTTL() time.Duration {
+	if rl.KeyTTL > 0 {
+		return time.Duration(rl.KeyTTL)
+	}
+	return defaultHashTTL
+}
+
+// streamAdd 在pipeline中用 XADD 写入一条stream消息：默认只有一个 data 字段，
+// 开启 StreamFields 时每个展开后的字段单独一个field。
+// MaxLen 用 MAXLEN ~ 近似裁剪，KeyTTL 同样刷新过期时间。
+func (rl *RedisLogger) streamAdd(ctx context.Context, pipe redis.Pipeliner, item logItem) {
+	args := &redis.XAddArgs{Stream: item.key}
+	if item.hash != nil {
+		args.Values = hashArgs(item.hash)
+	} else {
+		args.Values = []interface{}{"data", item.value}
+	}
+	if rl.MaxLen > 0 {
+		args.MaxLen = int64(rl.MaxLen)
+		args.Approx = true
+	}
+	pipe.XAdd(ctx, args)
+	if rl.KeyTTL > 0 {
+		pipe.Expire(ctx, item.key, time.Duration(rl.KeyTTL))
+	}
+}
@@ -0,0 +1,213 @@
+package redislogger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestHashOutput(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputHash
+		rl.RequestIDHeader = "X-Request-ID"
+	})
+	r := newTestRequest("POST", "/items?id=1", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	serve(t, rl, r, respond(201, "", "ok"))
+
+	key := "access:req-1"
+	fields, err := rl.client.get().HGetAll(context.Background(), key).Result()
+	if err != nil {
+		t.Fatalf("HGETALL %s: %v", key, err)
+	}
+	// 嵌套字段用点连接
+	for field, want := range map[string]string{
+		"request.method": "POST",
+		"request.uri":    "/items?id=1",
+		"status":         "201",
+		"request_id":     "req-1",
+	} {
+		if got := fields[field]; got != want {
+			t.Errorf("%s = %q, want %q", field, got, want)
+		}
+	}
+	if ttl := mr.TTL(key); ttl != defaultHashTTL {
+		t.Errorf("TTL = %v, want the default %v", ttl, defaultHashTTL)
+	}
+}
+
+func TestHashOutputWithoutRequestID(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputHash
+		rl.KeyTTL = caddy.Duration(time.Hour)
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+
+	// 没有请求ID时生成UUID作为key
+	keys := mr.Keys()
+	if len(keys) != 1 || len(keys[0]) != len("access:")+36 {
+		t.Fatalf("expected one access:<uuid> key, got %v", keys)
+	}
+	if ttl := mr.TTL(keys[0]); ttl != time.Hour {
+		t.Errorf("TTL = %v, want key_ttl 1h", ttl)
+	}
+}
+
+func TestHashOutputStderr(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputHash
+		rl.OnError = onErrorStderr
+		rl.WriteTimeout = 100 * time.Millisecond
+	})
+	mr.Close()
+
+	// 写入失败时hash的字段以一行JSON打印
+	stderr := captureStderr(t, func() {
+		rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/down", nil), respond(200, "", "ok"))
+	})
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(stderr), &fields); err != nil {
+		t.Fatalf("stderr is not a JSON object: %q", stderr)
+	}
+	if fields["request.uri"] != "/down" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestZsetOutput(t *testing.T) {
+	mr := miniredis.RunT(t)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := base
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputZset
+		rl.now = func() time.Time { return now }
+	})
+	for i, path := range []string{"/a", "/b", "/c"} {
+		now = base.Add(time.Duration(i) * time.Second)
+		serve(t, rl, newTestRequest("GET", path, nil), respond(200, "", "ok"))
+	}
+
+	// 按时间窗口取出 base+1s 的那一条，score 为Unix微秒数
+	from := strconv.FormatInt(base.Add(500*time.Millisecond).UnixMicro(), 10)
+	to := strconv.FormatInt(base.Add(1500*time.Millisecond).UnixMicro(), 10)
+	members, err := rl.client.get().ZRangeByScore(context.Background(), "access", &redis.ZRangeBy{Min: from, Max: to}).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 {
+		t.Fatalf("ZRANGEBYSCORE returned %d entries, want 1", len(members))
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(members[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if uri := entry["request"].(map[string]any)["uri"]; uri != "/b" {
+		t.Errorf("entry in the window has uri %v, want /b", uri)
+	}
+}
+
+func TestZsetMaxLen(t *testing.T) {
+	mr := miniredis.RunT(t)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := base
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputZset
+		rl.MaxLen = 2
+		rl.now = func() time.Time { return now }
+	})
+	rc := recordPipelines(rl)
+	for i := 0; i < 3; i++ {
+		now = base.Add(time.Duration(i) * time.Second)
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}
+
+	// ZREMRANGEBYRANK 去掉score最小（最早）的成员
+	members, err := mr.ZMembers("access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("sorted set has %d members, want 2", len(members))
+	}
+	for _, member := range members {
+		score, _ := mr.ZScore("access", member)
+		if score == float64(base.UnixMicro()) {
+			t.Errorf("the oldest entry was kept: %s", member)
+		}
+	}
+	for _, cmds := range rc.calls() {
+		if len(cmds) != 2 || cmds[0] != "zadd" || cmds[1] != "zremrangebyrank" {
+			t.Errorf("expected zadd and zremrangebyrank in one pipeline, got %v", cmds)
+		}
+	}
+}
+
+func TestStreamOutput(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputStream
+	})
+	serve(t, rl, newTestRequest("GET", "/a", nil), respond(200, "", "ok"))
+
+	// 默认整条日志放在 data 字段中
+	ctx := context.Background()
+	msgs, err := rl.client.get().XRange(ctx, "access", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || len(msgs[0].Values) != 1 {
+		t.Fatalf("unexpected stream messages %v", msgs)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(msgs[0].Values["data"].(string)), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["request"].(map[string]any)["uri"] != "/a" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestStreamFields(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputStream
+		rl.StreamFields = true
+		rl.RequestIDHeader = "X-Request-ID"
+	})
+	r := newTestRequest("POST", "/items?id=1", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+	serve(t, rl, r, respond(201, "", "ok"))
+
+	msgs, err := rl.client.get().XRange(context.Background(), "access", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("got %d stream messages, want 1", len(msgs))
+	}
+	// 每个展开后的字段单独一个field，没有 data 字段
+	values := msgs[0].Values
+	for field, want := range map[string]string{
+		"request.method": "POST",
+		"request.uri":    "/items?id=1",
+		"status":         "201",
+		"request_id":     "req-1",
+	} {
+		if got := values[field]; got != want {
+			t.Errorf("%s = %v, want %q", field, got, want)
+		}
+	}
+	if _, ok := values["data"]; ok {
+		t.Error("stream_fields message also has a data field")
+	}
+}
@@ -0,0 +1,73 @@
+package redislogger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// validateReliableQueue 检查 ReliableQueue 的约束：队列中的日志只能由消费者取走，
+// 任何裁剪或过期都会丢掉尚未处理的日志
+func (rl *RedisLogger) validateReliableQueue() error {
+	if !rl.ReliableQueue {
+		if rl.ProcessingKey != "" {
+			return fmt.Errorf("processing_key requires reliable_queue")
+		}
+		return nil
+	}
+	switch {
+	case rl.OutputMode != "" && rl.OutputMode != outputList:
+		return fmt.Errorf("reliable_queue requires output_mode list")
+	case rl.MaxLen > 0:
+		return fmt.Errorf("reliable_queue cannot be used with max_len, trimming would drop unconsumed entries")
+	case rl.KeyTTL > 0:
+		return fmt.Errorf("reliable_queue cannot be used with key_ttl, expiry would drop unconsumed entries")
+	case rl.UseScript:
+		return fmt.Errorf("reliable_queue cannot be used with use_script")
+	case rl.ProcessingKey != "" && (rl.keyHasPlaceholders || rl.timeKeys != nil || len(rl.RedisKeys) > 0 || rl.ShardByMethod):
+		return fmt.Errorf("processing_key requires a single redis_key without placeholders")
+	}
+	return nil
+}
+
+// requeuedQueues 记录本进程已经恢复过的处理中列表。
+// 重载配置时消费者仍在正常处理，不能再次把它们手上的日志放回队列，否则会被重复消费。
+var requeuedQueues sync.Map
+
+// requeueProcessing 把 ProcessingKey 中残留的日志按原顺序放回队列头部，
+// 让崩溃的消费者取走但没处理完的日志被重新消费。每个进程对同一个列表只做一次。
+// 消费者用 LMOVE <queue> <processing> LEFT RIGHT 取日志，这里从 processing 尾部取出、
+// 放回 queue 头部，最早取走的日志最先被再次消费。
+func (rl *RedisLogger) requeueProcessing(ctx context.Context, client redisClient) error {
+	if rl.ProcessingKey == "" {
+		return nil
+	}
+	queue := rl.KeyPrefix + rl.RedisKey
+	processing := rl.KeyPrefix + rl.ProcessingKey
+	id := fmt.Sprintf("%s/%d/%s", rl.displayAddress(), rl.db(), processing)
+	if _, done := requeuedQueues.LoadOrStore(id, struct{}{}); done {
+		return nil
+	}
+
+	requeued := 0
+	for {
+		err := client.RPopLPush(ctx, processing, queue).Err()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		requeued++
+	}
+	if requeued > 0 {
+		rl.logger.Info("Requeued unacknowledged entries",
+			zap.String("processing_key", processing),
+			zap.Int("entries", requeued),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package redislogger
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestReliableQueueRequeue(t *testing.T) {
+	mr := miniredis.RunT(t)
+	configure := func(rl *RedisLogger) {
+		rl.RedisKey = "logs:queue"
+		rl.ReliableQueue = true
+		rl.ProcessingKey = "logs:processing"
+	}
+	rl := newTestLogger(t, mr, configure)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		serve(t, rl, newTestRequest("GET", path, nil), respond(200, "", "ok"))
+	}
+	// RPUSH写入，列表头部是最早的日志
+	pushed, _ := mr.List("logs:queue")
+	if len(pushed) != 3 {
+		t.Fatalf("queue has %d entries, want 3", len(pushed))
+	}
+
+	// 消费者取走两条后崩溃，日志留在处理中列表
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := rl.client.get().LMove(ctx, "logs:queue", "logs:processing", "LEFT", "RIGHT").Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 重载配置不会把消费者手上的日志放回队列
+	newTestLogger(t, mr, configure)
+	if n := listLen(mr, "logs:processing"); n != 2 {
+		t.Fatalf("reload requeued the processing list, %d entries left in it", n)
+	}
+
+	// 进程重启后第一次加载配置时按原顺序放回队列头部，内容不变
+	requeuedQueues.Range(func(key, _ any) bool {
+		requeuedQueues.Delete(key)
+		return true
+	})
+	newTestLogger(t, mr, configure)
+	if n := listLen(mr, "logs:processing"); n != 0 {
+		t.Errorf("%d entries left in the processing list after a restart", n)
+	}
+	if requeued, _ := mr.List("logs:queue"); !reflect.DeepEqual(requeued, pushed) {
+		t.Errorf("queue after requeue = %v, want %v", requeued, pushed)
+	}
+}
@@ -0,0 +1,97 @@
+package redislogger
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// 模板key展开后数量不受控，限流器超过这个数量时全部重建，避免内存无限增长
+const maxRateLimiters = 10000
+
+// keyLimiters 为每个展开后的key维护一个令牌桶
+type keyLimiters struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*rate.Limiter
+}
+
+// newKeyLimiters 创建每秒最多 perSecond 次写入的限流器，允许一秒的突发
+func newKeyLimiters(perSecond float64) *keyLimiters {
+	return &keyLimiters{
+		limit:    rate.Limit(perSecond),
+		burst:    max(1, int(perSecond)),
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// allow 判断这个key现在能否写入
+func (kl *keyLimiters) allow(key string) bool {
+	return kl.get(key).Allow()
+}
+
+// wait 等到这个key可以写入，ctx 取消时返回错误
+func (kl *keyLimiters) wait(ctx context.Context, key string) error {
+	return kl.get(key).Wait(ctx)
+}
+
+// get 返回key的令牌桶，不存在时创建
+func (kl *keyLimiters) get(key string) *rate.Limiter {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	limiter, ok := kl.limiters[key]
+	if !ok {
+		if len(kl.limiters) >= maxRateLimiters {
+			kl.limiters = make(map[string]*rate.Limiter)
+		}
+		limiter = rate.NewLimiter(kl.limit, kl.burst)
+		kl.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// rateLimit 去掉超过 MaxPushesPerSecond 的日志：开启落盘时写入落盘文件，重放时同样受限流控制；否则丢弃并计数
+func (rl *RedisLogger) rateLimit(items []logItem) []logItem {
+	if rl.limiters == nil {
+		return items
+	}
+	allowed := items[:0]
+	var limited []logItem
+	for _, item := range items {
+		if rl.limiters.allow(item.limitKey()) {
+			allowed = append(allowed, item)
+		} else {
+			limited = append(limited, item)
+		}
+	}
+	if len(limited) == 0 {
+		return allowed
+	}
+
+	if rl.spill != nil {
+		if err := rl.spill.write(limited); err == nil {
+			return allowed
+		}
+	}
+	for _, item := range limited {
+		rl.metrics.drop(dropReasonRateLimited)
+		rl.logger.Debug("Push rate limit exceeded, dropping entry", zap.String("key", item.key))
+	}
+	return allowed
+}
+
+// waitRateLimit 等到批次中的每条日志都拿到令牌，用于重放落盘的日志
+func (rl *RedisLogger) waitRateLimit(ctx context.Context, items []logItem) error {
+	if rl.limiters == nil {
+		return nil
+	}
+	for _, item := range items {
+		if err := rl.limiters.wait(ctx, item.limitKey()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package redislogger
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestRateLimitDropsExcess(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisKey = "access:{http.request.host}"
+		rl.MaxPushesPerSecond = 5
+	})
+
+	// 令牌每200ms才补充一个，连续的请求只有突发量内的能写入
+	for i := 0; i < 10; i++ {
+		serve(t, rl, newTestRequest("GET", "http://busy.example/", nil), respond(200, "", "ok"))
+	}
+	serve(t, rl, newTestRequest("GET", "http://quiet.example/", nil), respond(200, "", "ok"))
+
+	if n := listLen(mr, "access:busy.example"); n != 5 {
+		t.Errorf("busy key got %d entries, want 5", n)
+	}
+	// 每个展开后的key有自己的令牌桶
+	if n := listLen(mr, "access:quiet.example"); n != 1 {
+		t.Errorf("quiet key got %d entries, want 1", n)
+	}
+	if dropped := rl.metrics.droppedTotal.Load(); dropped != 5 {
+		t.Errorf("dropped = %d, want 5", dropped)
+	}
+}
+
+func TestRateLimitSpills(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.MaxPushesPerSecond = 10
+		rl.SpillDir = t.TempDir()
+		rl.SpillRetryInterval = caddy.Duration(20 * time.Millisecond)
+	})
+
+	// 开启落盘时超出限制的日志稍后重放，不会丢失
+	for i := 0; i < 12; i++ {
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}
+	start := time.Now()
+	if dropped := rl.metrics.droppedTotal.Load(); dropped != 0 {
+		t.Errorf("dropped = %d, want 0 with spilling enabled", dropped)
+	}
+	waitFor(t, "rate limited entries to be replayed", func() bool { return listLen(mr, "access") == 12 })
+
+	// 令牌已经用完，重放的两条要等两个令牌（约200ms），而不是在下一次重放时立即写入
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("spilled entries replayed after %v, replay should wait for the rate limit", elapsed)
+	}
+}
+
+func TestRateLimitHashOutput(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.OutputMode = outputHash
+		rl.MaxPushesPerSecond = 5
+	})
+
+	// hash 模式下每条日志的key都不同，限流仍然按 redis_key 计算
+	for i := 0; i < 10; i++ {
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}
+	if n := len(mr.Keys()); n != 5 {
+		t.Errorf("got %d hashes, want 5", n)
+	}
+	if dropped := rl.metrics.droppedTotal.Load(); dropped != 5 {
+		t.Errorf("dropped = %d, want 5", dropped)
+	}
+}
+
+func TestKeyLimitersReset(t *testing.T) {
+	kl := newKeyLimiters(1)
+	for i := 0; i < maxRateLimiters; i++ {
+		kl.allow(strconv.Itoa(i))
+	}
+	kl.allow("one more")
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if len(kl.limiters) != 1 {
+		t.Errorf("limiters = %d after exceeding the cap, want 1", len(kl.limiters))
+	}
+}
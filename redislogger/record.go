@@ -0,0 +1,288 @@
+package redislogger
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// accessEntry 是一条访问日志。字段按名称排序，直接序列化的结果与 toMap 之后
+// 再序列化的结果逐字节相同（encoding/json 对map的key排序）。
+// 默认配置下直接序列化这个结构体，省去每个请求构造map的分配。
+type accessEntry struct {
+	AuthPresent           *bool                  `json:"auth_present,omitempty"`
+	BodySkipped           bool                   `json:"body_skipped,omitempty"`
+	BytesRead             int64                  `json:"bytes_read"`
+	BytesWritten          int64                  `json:"bytes_written,omitempty"`
+	ContentLength         *int64                 `json:"content_length,omitempty"`
+	ContentLengthMismatch bool                   `json:"content_length_mismatch,omitempty"`
+	Count                 int                    `json:"count,omitempty"`
+	Duration              interface{}            `json:"duration"`
+	Error                 string                 `json:"error,omitempty"`
+	Fingerprint           string                 `json:"fingerprint,omitempty"`
+	Geo                   map[string]string      `json:"geo,omitempty"`
+	HeaderBytes           int64                  `json:"header_bytes,omitempty"`
+	HeadersTruncated      bool                   `json:"headers_truncated,omitempty"`
+	Meta                  map[string]string      `json:"meta,omitempty"`
+	ReceivedAt            interface{}            `json:"received_at,omitempty"`
+	Request               accessRequest          `json:"request"`
+	RequestBody           *string                `json:"request_body,omitempty"`
+	RequestBodyError      string                 `json:"request_body_error,omitempty"`
+	RequestBodyTruncated  bool                   `json:"request_body_truncated,omitempty"`
+	RequestID             string                 `json:"request_id,omitempty"`
+	RequestLine           string                 `json:"request_line,omitempty"`
+	RequestUUID           string                 `json:"request_uuid,omitempty"`
+	RespHeaders           http.Header            `json:"resp_headers"`
+	ResponseBody          *string                `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool                   `json:"response_body_truncated,omitempty"`
+	Server                map[string]interface{} `json:"server"`
+	Size                  int                    `json:"size"`
+	Slow                  bool                   `json:"slow,omitempty"`
+	Status                int                    `json:"status"`
+	Ts                    interface{}            `json:"ts"`
+	Upstream              string                 `json:"upstream,omitempty"`
+
+	at time.Time // 日志时间，zset 模式下作为score，不序列化
+}
+
+// accessRequest 是日志中的 request 对象
+type accessRequest struct {
+	ClientIP   string            `json:"client_ip"`
+	Cookies    map[string]string `json:"cookies,omitempty"`
+	Headers    http.Header       `json:"headers"`
+	Host       string            `json:"host"`
+	Method     string            `json:"method"`
+	Proto      string            `json:"proto"`
+	Query      url.Values        `json:"query,omitempty"`
+	RemoteIP   string            `json:"remote_ip"`
+	RemotePort string            `json:"remote_port"`
+	Scheme     string            `json:"scheme"`
+	TLS        *accessTLS        `json:"tls,omitempty"`
+	URI        string            `json:"uri"`
+}
+
+// accessTLS 是日志中的 request.tls 对象
+type accessTLS struct {
+	CipherSuite       uint16 `json:"cipher_suite"`
+	ClientCertSerial  string `json:"client_cert_serial,omitempty"`
+	ClientCertSubject string `json:"client_cert_subject,omitempty"`
+	Proto             string `json:"proto"`
+	Resumed           bool   `json:"resumed"`
+	ServerName        string `json:"server_name"`
+	Version           uint16 `json:"version"`
+}
+
+// newAccessTLS 从连接状态中取出TLS信息，明文HTTP请求返回nil。
+// mTLS 时记录客户端证书（链上第一张）的主题与序列号。
+func newAccessTLS(state *tls.ConnectionState) *accessTLS {
+	if state == nil {
+		return nil
+	}
+	info := &accessTLS{
+		Resumed:     state.DidResume,
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+		Proto:       state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		info.ClientCertSubject = cert.Subject.String()
+		if cert.SerialNumber != nil {
+			info.ClientCertSerial = cert.SerialNumber.String()
+		}
+	}
+	return info
+}
+
+var (
+	entryPool = sync.Pool{
+		New: func() interface{} { return new(accessEntry) },
+	}
+	encoderPool = sync.Pool{
+		New: func() interface{} {
+			e := &pooledEncoder{}
+			e.enc = json.NewEncoder(&e.buf)
+			return e
+		},
+	}
+)
+
+// getEntry 从池中取出一个空的 accessEntry
+func getEntry() *accessEntry {
+	return entryPool.Get().(*accessEntry)
+}
+
+// putEntry 清空后放回池中
+func putEntry(e *accessEntry) {
+	*e = accessEntry{}
+	entryPool.Put(e)
+}
+
+// pooledEncoder 是绑定在缓冲区上的 json.Encoder，两者一起复用
+type pooledEncoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// 超过这个容量的缓冲区不放回池中，避免偶尔的超大日志让池长期占用内存
+const maxPooledBufSize = 64 << 10
+
+// marshalJSON 用池化的缓冲区序列化
+func (e *accessEntry) marshalJSON() ([]byte, error) {
+	return marshalJSONPooled(e)
+}
+
+// marshalJSONPooled 与 json.Marshal 的输出相同，但复用池中的缓冲区，
+// 只为结果分配一次。返回的切片是新分配的，可以安全地交给异步写入。
+func marshalJSONPooled(v interface{}) ([]byte, error) {
+	e := encoderPool.Get().(*pooledEncoder)
+	defer func() {
+		if e.buf.Cap() <= maxPooledBufSize {
+			encoderPool.Put(e)
+		}
+	}()
+	e.buf.Reset()
+
+	if err := e.enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encoder 会在末尾加换行，json.Marshal 不会
+	return bytes.Clone(bytes.TrimSuffix(e.buf.Bytes(), []byte{'\n'})), nil
+}
+
+// toMap 转为map，供字段筛选、重命名、ECS等需要修改结构的功能使用
+func (e *accessEntry) toMap() map[string]interface{} {
+	entry := map[string]interface{}{
+		"ts": e.Ts,
+		"request": map[string]interface{}{
+			"remote_ip":   e.Request.RemoteIP,
+			"remote_port": e.Request.RemotePort,
+			"scheme":      e.Request.Scheme,
+			"client_ip":   e.Request.ClientIP,
+			"proto":       e.Request.Proto,
+			"method":      e.Request.Method,
+			"host":        e.Request.Host,
+			"uri":         e.Request.URI,
+			"headers":     e.Request.Headers,
+		},
+		"bytes_read":   e.BytesRead,
+		"duration":     e.Duration,
+		"size":         e.Size,
+		"status":       e.Status,
+		"resp_headers": e.RespHeaders,
+		"server":       e.Server,
+	}
+	if t := e.Request.TLS; t != nil {
+		tlsInfo := map[string]interface{}{
+			"resumed":      t.Resumed,
+			"version":      t.Version,
+			"cipher_suite": t.CipherSuite,
+			"proto":        t.Proto,
+			"server_name":  t.ServerName,
+		}
+		if t.ClientCertSubject != "" {
+			tlsInfo["client_cert_subject"] = t.ClientCertSubject
+		}
+		if t.ClientCertSerial != "" {
+			tlsInfo["client_cert_serial"] = t.ClientCertSerial
+		}
+		entry["request"].(map[string]interface{})["tls"] = tlsInfo
+	}
+	if len(e.Request.Cookies) > 0 {
+		entry["request"].(map[string]interface{})["cookies"] = e.Request.Cookies
+	}
+	if len(e.Request.Query) > 0 {
+		entry["request"].(map[string]interface{})["query"] = e.Request.Query
+	}
+	if e.AuthPresent != nil {
+		entry["auth_present"] = *e.AuthPresent
+	}
+	if e.BytesWritten > 0 {
+		entry["bytes_written"] = e.BytesWritten
+		entry["header_bytes"] = e.HeaderBytes
+	}
+	if e.ContentLength != nil {
+		entry["content_length"] = *e.ContentLength
+	}
+	if e.ContentLengthMismatch {
+		entry["content_length_mismatch"] = true
+	}
+	if e.Fingerprint != "" {
+		entry["fingerprint"] = e.Fingerprint
+	}
+	if e.Count > 0 {
+		entry["count"] = e.Count
+	}
+	if e.ReceivedAt != nil {
+		entry["received_at"] = e.ReceivedAt
+	}
+	if len(e.Geo) > 0 {
+		entry["geo"] = e.Geo
+	}
+	if len(e.Meta) > 0 {
+		// meta 在所有请求之间共享，复制一份，避免转换器修改
+		meta := make(map[string]string, len(e.Meta))
+		for k, v := range e.Meta {
+			meta[k] = v
+		}
+		entry["meta"] = meta
+	}
+	if e.Error != "" {
+		entry["error"] = e.Error
+	}
+	if e.HeadersTruncated {
+		entry["headers_truncated"] = true
+	}
+	if e.BodySkipped {
+		entry["body_skipped"] = true
+	}
+	if e.Slow {
+		entry["slow"] = true
+	}
+	if e.RequestID != "" {
+		entry["request_id"] = e.RequestID
+	}
+	if e.RequestLine != "" {
+		entry["request_line"] = e.RequestLine
+	}
+	if e.RequestUUID != "" {
+		entry["request_uuid"] = e.RequestUUID
+	}
+	if e.Upstream != "" {
+		entry["upstream"] = e.Upstream
+	}
+	if e.RequestBody != nil {
+		entry["request_body"] = *e.RequestBody
+		if e.RequestBodyError != "" {
+			entry["request_body_error"] = e.RequestBodyError
+		}
+		if e.RequestBodyTruncated {
+			entry["request_body_truncated"] = true
+		}
+	}
+	if e.ResponseBody != nil {
+		entry["response_body"] = *e.ResponseBody
+		if e.ResponseBodyTruncated {
+			entry["response_body_truncated"] = true
+		}
+	}
+	return entry
+}
+
+// fastPathEnabled 判断当前配置能否直接序列化 accessEntry：
+// 只要用到了需要修改日志结构的功能，就退回map
+func (rl *RedisLogger) fastPathEnabled() bool {
+	return (rl.Format == "" || rl.Format == formatJSON) &&
+		len(rl.Fields) == 0 &&
+		len(rl.FieldMap) == 0 &&
+		len(rl.TransformersRaw) == 0 &&
+		rl.EnvelopeType == "" &&
+		(rl.OutputSchema == "" || rl.OutputSchema == schemaNative) &&
+		(rl.OutputMode == "" || rl.OutputMode == outputList || (rl.OutputMode == outputStream && !rl.StreamFields) || rl.OutputMode == outputZset) &&
+		rl.MaxEntryBytes == 0
+}
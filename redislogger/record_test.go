@@ -0,0 +1,224 @@
+package redislogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// fullEntry 返回每个字段都有值的日志
+func fullEntry() *accessEntry {
+	authPresent := false
+	contentLength := int64(6)
+	requestBody, responseBody := `{"q":1}`, "<html>"
+	return &accessEntry{
+		AuthPresent:           &authPresent,
+		BodySkipped:           true,
+		BytesRead:             7,
+		BytesWritten:          120,
+		ContentLength:         &contentLength,
+		ContentLengthMismatch: true,
+		Count:                 3,
+		Duration:              0.0125,
+		Error:                 "upstream timeout",
+		Fingerprint:           "9f86d081884c7d65",
+		Geo:                   map[string]string{"country": "NL"},
+		HeaderBytes:           114,
+		HeadersTruncated:      true,
+		Meta:                  map[string]string{"dc": "ams1"},
+		ReceivedAt:            "2024-06-01T12:00:00Z",
+		Request: accessRequest{
+			ClientIP:   "203.0.113.7",
+			Cookies:    map[string]string{"session": "abc"},
+			Headers:    http.Header{"Accept": {"*/*"}, "X-Multi": {"a", "b"}},
+			Host:       "example.com",
+			Method:     "POST",
+			Proto:      "HTTP/2.0",
+			Query:      url.Values{"q": {"go"}},
+			RemoteIP:   "192.0.2.1",
+			RemotePort: "54321",
+			Scheme:     "https",
+			TLS: &accessTLS{
+				CipherSuite:       0x1301,
+				ClientCertSerial:  "123456",
+				ClientCertSubject: "CN=client",
+				Proto:             "h2",
+				Resumed:           true,
+				ServerName:        "example.com",
+				Version:           0x0304,
+			},
+			URI: "/search?q=go",
+		},
+		RequestBody:           &requestBody,
+		RequestBodyError:      "unexpected EOF",
+		RequestBodyTruncated:  true,
+		RequestID:             "req-1",
+		RequestLine:           "POST /search?q=go HTTP/2.0",
+		RequestUUID:           "5f0c4a1e-3f6b-4d2a-9c1e-7b8a9d0e1f23",
+		RespHeaders:           http.Header{"Content-Type": {"text/html"}},
+		ResponseBody:          &responseBody,
+		ResponseBodyTruncated: true,
+		Server:                map[string]interface{}{"name": "srv0"},
+		Size:                  6,
+		Slow:                  true,
+		Status:                502,
+		Ts:                    "2024-06-01T12:00:00.0125Z",
+		Upstream:              "10.0.0.5:8080",
+	}
+}
+
+// assertAllFieldsSet 检查结构体的每个导出字段都不是零值，新增字段时提醒同时更新 fullEntry
+func assertAllFieldsSet(t *testing.T, v reflect.Value) {
+	t.Helper()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if v.Field(i).IsZero() {
+			t.Errorf("fullEntry leaves %s.%s unset", v.Type().Name(), field.Name)
+		}
+	}
+}
+
+func TestAccessEntryMatchesMap(t *testing.T) {
+	full := fullEntry()
+	assertAllFieldsSet(t, reflect.ValueOf(*full))
+	assertAllFieldsSet(t, reflect.ValueOf(full.Request))
+	assertAllFieldsSet(t, reflect.ValueOf(*full.Request.TLS))
+
+	minimal := &accessEntry{
+		Duration: 0.001,
+		Request:  accessRequest{Method: "GET", URI: "/"},
+		Status:   200,
+		Ts:       int64(1717243200),
+	}
+
+	for name, e := range map[string]*accessEntry{"full": full, "minimal": minimal} {
+		want, err := json.Marshal(e.toMap())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := e.marshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: struct JSON differs from the map form\nstruct: %s\nmap:    %s", name, got, want)
+		}
+	}
+}
+
+func TestMarshalJSONPooledReuse(t *testing.T) {
+	// 每个entry预先用 json.Marshal 算出期望结果，其中一条超过放回池中的上限
+	entries := make([]*accessEntry, 16)
+	want := make([][]byte, len(entries))
+	for i := range entries {
+		entries[i] = &accessEntry{
+			Duration: 0.001,
+			Request:  accessRequest{Method: "GET", URI: "/" + strconv.Itoa(i)},
+			Status:   200,
+			Ts:       int64(i),
+		}
+		if i == 3 {
+			body := strings.Repeat("x", maxPooledBufSize)
+			entries[i].RequestBody = &body
+		}
+		var err error
+		if want[i], err = json.Marshal(entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 并发序列化同时复用池中的缓冲区，结果之间互不影响，
+	// 全部结束后再检查，确认返回的切片没有引用会被复用的缓冲区
+	const rounds = 50
+	results := make([][][]byte, len(entries))
+	var wg sync.WaitGroup
+	for i := range entries {
+		results[i] = make([][]byte, rounds)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				got, err := entries[i].marshalJSON()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results[i][j] = got
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range entries {
+		for j, got := range results[i] {
+			if !bytes.Equal(got, want[i]) {
+				t.Fatalf("entry %d, round %d: got %s, want %s", i, j, got, want[i])
+			}
+		}
+	}
+}
+
+// benchmarkServeHTTP 测量一次请求的耗时与分配，configure 为nil时走 fastPath
+func benchmarkServeHTTP(b *testing.B, configure func(*RedisLogger)) {
+	mr := miniredis.RunT(b)
+	rl := newTestLogger(b, mr, func(rl *RedisLogger) {
+		rl.MaxLen = 1000
+		if configure != nil {
+			configure(rl)
+		}
+	})
+	next := respond(200, "text/plain", "ok")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rl.ServeHTTP(discardWriter{header: http.Header{}}, newTestRequest("GET", "/bench?x=1", nil), next)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	b.Run("struct", func(b *testing.B) { benchmarkServeHTTP(b, nil) })
+	// 不改变结果的 field_map 同样会关闭 fastPath，用来测量构造map的开销
+	b.Run("map", func(b *testing.B) {
+		benchmarkServeHTTP(b, func(rl *RedisLogger) { rl.FieldMap = map[string]string{"ts": "ts"} })
+	})
+}
+
+func BenchmarkMarshalEntry(b *testing.B) {
+	e := fullEntry()
+	b.Run("struct", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := e.marshalJSON(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(e.toMap()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// discardWriter 是丢弃响应体的 http.ResponseWriter，避免基准测试受 httptest.ResponseRecorder 的分配影响
+type discardWriter struct {
+	header http.Header
+}
+
+func (w discardWriter) Header() http.Header         { return w.header }
+func (w discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w discardWriter) WriteHeader(int)             {}
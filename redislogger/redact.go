@@ -0,0 +1,116 @@
+package redislogger
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redactedValue 替换被脱敏字段的值
+const redactedValue = "REDACTED"
+
+// redactHeaders 返回脱敏后的header副本，原header不会被修改；没有需要脱敏的header时原样返回
+func (rl *RedisLogger) redactHeaders(header http.Header) http.Header {
+	if len(rl.redactHeaderSet) == 0 {
+		return header
+	}
+
+	var redacted http.Header
+	for name, values := range header {
+		if _, ok := rl.redactHeaderSet[http.CanonicalHeaderKey(name)]; !ok {
+			continue
+		}
+		if redacted == nil {
+			redacted = header.Clone()
+		}
+		masked := make([]string, len(values))
+		for i := range masked {
+			masked[i] = redactedValue
+		}
+		redacted[name] = masked
+	}
+	if redacted == nil {
+		return header
+	}
+	return redacted
+}
+
+// redactURI 对URI查询串中需要脱敏的参数打码，路径与其余参数保持原样
+func (rl *RedisLogger) redactURI(uri string) string {
+	if len(rl.redactParamSet) == 0 {
+		return uri
+	}
+	path, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok || rawQuery == "" {
+		return uri
+	}
+
+	params := strings.Split(rawQuery, "&")
+	changed := false
+	for i, param := range params {
+		rawKey, _, _ := strings.Cut(param, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		if _, ok := rl.redactParamSet[strings.ToLower(key)]; ok {
+			params[i] = rawKey + "=" + redactedValue
+			changed = true
+		}
+	}
+	if !changed {
+		return uri
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// redactQuery 返回打码后的查询参数副本
+func (rl *RedisLogger) redactQuery(query url.Values) url.Values {
+	if len(rl.redactParamSet) == 0 {
+		return query
+	}
+	out := make(url.Values, len(query))
+	for key, values := range query {
+		if _, ok := rl.redactParamSet[strings.ToLower(key)]; ok {
+			redacted := make([]string, len(values))
+			for i := range values {
+				redacted[i] = redactedValue
+			}
+			values = redacted
+		}
+		out[key] = values
+	}
+	return out
+}
+
+// cookies 把请求中的cookie解析为 名称->值，同名cookie取第一个，Redact 中的名称打码
+func (rl *RedisLogger) cookies(r *http.Request) map[string]string {
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(cookies))
+	for _, c := range cookies {
+		if _, ok := out[c.Name]; ok {
+			continue
+		}
+		value := c.Value
+		if _, ok := rl.redactParamSet[strings.ToLower(c.Name)]; ok {
+			value = redactedValue
+		}
+		out[c.Name] = value
+	}
+	return out
+}
+
+// redactParams 把 Redact 中的名称转成小写集合，用于匹配查询参数与cookie名称
+func redactParams(names []string) map[string]struct{} {
+	if len(names) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,90 @@
+package redislogger
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestRedactURI(t *testing.T) {
+	rl := &RedisLogger{redactParamSet: redactParams([]string{"Token", "api_key"})}
+	for _, tc := range []struct {
+		uri, want string
+	}{
+		{"/path", "/path"},
+		{"/path?", "/path?"},
+		{"/path?page=2", "/path?page=2"},
+		{"/path?token=abc&page=2", "/path?token=REDACTED&page=2"},
+		{"/path?TOKEN=abc&api%5Fkey=x", "/path?TOKEN=REDACTED&api%5Fkey=REDACTED"},
+		{"/path?token", "/path?token=REDACTED"},
+	} {
+		if got := rl.redactURI(tc.uri); got != tc.want {
+			t.Errorf("redactURI(%q) = %q, want %q", tc.uri, got, tc.want)
+		}
+	}
+}
+
+func TestRedactHeadersCopies(t *testing.T) {
+	rl := &RedisLogger{redactHeaderSet: headerSet([]string{"authorization"})}
+	header := http.Header{"Authorization": {"Bearer secret"}, "Accept": {"*/*"}}
+
+	redacted := rl.redactHeaders(header)
+	if redacted.Get("Authorization") != redactedValue || redacted.Get("Accept") != "*/*" {
+		t.Errorf("unexpected redacted headers %v", redacted)
+	}
+	// 原header还要交给下游handler，不能被修改
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Error("the original header was modified")
+	}
+}
+
+func TestRedactInEntry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Redact = []string{"Authorization", "token"}
+	})
+
+	var seen string
+	r := newTestRequest("GET", "/?token=abc", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	next := respond(200, "", "ok")
+	serve(t, rl, r, caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		seen = r.Header.Get("Authorization")
+		return next(w, r)
+	}))
+	if seen != "Bearer secret" {
+		t.Errorf("downstream saw %q", seen)
+	}
+
+	request := lastEntry(t, mr, "access")["request"].(map[string]any)
+	if request["uri"] != "/?token=REDACTED" {
+		t.Errorf("uri = %v", request["uri"])
+	}
+	auth := request["headers"].(map[string]any)["Authorization"].([]any)
+	if len(auth) != 1 || auth[0] != redactedValue {
+		t.Errorf("Authorization = %v", auth)
+	}
+}
+
+func TestCookiesInEntry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.WithCookies = true
+		rl.Redact = []string{"Session"}
+	})
+
+	r := newTestRequest("GET", "/", nil)
+	r.Header.Add("Cookie", "session=abc123; theme=dark")
+	r.Header.Add("Cookie", "theme=light")
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	// 名称不区分大小写地匹配 Redact，同名的cookie只保留第一个
+	cookies := lastEntry(t, mr, "access")["request"].(map[string]any)["cookies"]
+	want := map[string]any{"session": redactedValue, "theme": "dark"}
+	if !reflect.DeepEqual(cookies, want) {
+		t.Errorf("cookies = %v, want %v", cookies, want)
+	}
+}
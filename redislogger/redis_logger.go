@@ -1,44 +1,424 @@
 package redislogger
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/netip"
+	"strings"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
-	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 type RedisLogger struct {
+	RedisURL      string        `json:"redis_url,omitempty"` // 完整连接URL，设置后覆盖地址、密码与DB
 	RedisAddress  string        `json:"redis_address,omitempty"`
+	RedisUsername string        `json:"redis_username,omitempty"` // Redis 6 ACL 用户名
 	RedisPassword string        `json:"redis_password,omitempty"`
-	RedisDB       int           `json:"redis_db,omitempty"`
+	RedisDB       *int          `json:"redis_db,omitempty"` // 未设置时为nil，与显式的 redis_db 0 区分
 	RedisKey      string        `json:"redis_key"`
+	RedisKeys     []string      `json:"redis_keys,omitempty"` // 额外写入的key，每条日志同时写入 RedisKey 与这些key
 	WithBody      bool          `json:"with_body,omitempty"`
+	MaxBodySize   int64         `json:"max_body_size,omitempty"` // 请求体最多记录的字节数，默认1MiB
 	DialTimeout   time.Duration `json:"dial_timeout,omitempty"`  // 连接超时时间
 	ReadTimeout   time.Duration `json:"read_timeout,omitempty"`  // 读取超时时间
 	WriteTimeout  time.Duration `json:"write_timeout,omitempty"` // 写入超时时间
 	MaxRetries    int           `json:"max_retries,omitempty"`   // 最大重试次数
-	client        *redis.Client
-	logger        *zap.Logger
+	ClusterAddrs  []string      `json:"cluster_addrs,omitempty"` // 集群节点地址，非空时使用集群模式
+
+	WithResponseBody    bool  `json:"with_response_body,omitempty"`     // 记录响应体，开启后响应会先缓冲在内存中
+	MaxResponseBodySize int64 `json:"max_response_body_size,omitempty"` // 响应体最多记录的字节数，默认1MiB
+
+	MaxLen int            `json:"max_len,omitempty"` // 列表最大长度，超出部分通过LTRIM裁掉，0表示不限制
+	KeyTTL caddy.Duration `json:"key_ttl,omitempty"` // 每次写入后刷新key的过期时间，0表示不过期
+
+	PoolSize           int            `json:"pool_size,omitempty"`            // 连接池大小，默认 10*GOMAXPROCS
+	MinIdleConns       int            `json:"min_idle_conns,omitempty"`       // 最小空闲连接数
+	PoolTimeout        caddy.Duration `json:"pool_timeout,omitempty"`         // 从连接池获取连接的等待时间
+	IdleTimeout        caddy.Duration `json:"idle_timeout,omitempty"`         // 空闲连接的关闭时间，默认5分钟，-1表示不关闭；应小于Redis的timeout配置
+	MaxConnAge         caddy.Duration `json:"max_conn_age,omitempty"`         // 连接的最长使用时间，0表示不限制
+	IdleCheckFrequency caddy.Duration `json:"idle_check_frequency,omitempty"` // 清理空闲连接的间隔，默认1分钟，-1表示不清理
+
+	TLS                   bool   `json:"tls,omitempty"`                      // 是否使用TLS连接
+	TLSCACert             string `json:"tls_ca_cert,omitempty"`              // CA证书文件
+	TLSClientCert         string `json:"tls_client_cert,omitempty"`          // 客户端证书文件
+	TLSClientKey          string `json:"tls_client_key,omitempty"`           // 客户端私钥文件
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify,omitempty"` // 跳过服务端证书校验
+
+	BufferSize    int            `json:"buffer_size,omitempty"`    // 缓冲队列长度，大于0时开启异步批量写入
+	BatchSize     int            `json:"batch_size,omitempty"`     // 每批写入的条数，默认100
+	FlushInterval caddy.Duration `json:"flush_interval,omitempty"` // 未攒满一批时的最长写入间隔，默认1s
+	DropOnFull    bool           `json:"drop_on_full,omitempty"`   // 队列已满时丢弃日志，否则直接写入Redis
+
+	HeaderInclude []string `json:"header_include,omitempty"` // 只记录这些请求头，不区分大小写
+	HeaderExclude []string `json:"header_exclude,omitempty"` // 不记录这些请求头，优先于 HeaderInclude
+
+	Redact []string `json:"redact,omitempty"` // 需要脱敏的header名称、查询参数名与cookie名称，值会被替换为 REDACTED
+
+	LogStatus []string `json:"log_status,omitempty"` // 只记录这些状态码的响应，如 404、400-599
+
+	SkipPaths   []string `json:"skip_paths,omitempty"`   // 不记录这些路径的请求，语法同Caddy的path匹配器，如 /healthz、/static/*
+	SkipMethods []string `json:"skip_methods,omitempty"` // 不记录这些方法的请求，如 OPTIONS
+
+	SampleRate       float64 `json:"sample_rate,omitempty"`        // 采样比例 0~1，未设置时全部记录
+	SampleKeepErrors bool    `json:"sample_keep_errors,omitempty"` // 非2xx响应不参与采样，总是记录
+
+	Fields []string `json:"fields,omitempty"` // 只记录这些顶层字段，如 request、duration、status，默认全部记录
+
+	TimeFormat string `json:"time_format,omitempty"` // ts 的格式：Go时间布局或 unix、unix_ms、unix_nano，默认 RFC3339Nano
+
+	Format string `json:"format,omitempty"` // 序列化格式：json（默认）或 msgpack
+
+	Compress          bool `json:"compress,omitempty"`           // 用gzip压缩较大的日志，压缩后的值以 0x01 开头
+	CompressThreshold int  `json:"compress_threshold,omitempty"` // 超过该字节数才压缩，默认1024
+
+	OnError string `json:"on_error,omitempty"` // 写入失败时的策略：ignore（默认）、stderr、fail
+
+	SpillDir           string         `json:"spill_dir,omitempty"`            // Redis不可用时把日志落盘到该目录，恢复后重新写入
+	SpillMaxBytes      int64          `json:"spill_max_bytes,omitempty"`      // 落盘文件的最大字节数，默认100MiB
+	SpillRetryInterval caddy.Duration `json:"spill_retry_interval,omitempty"` // 重放落盘日志的间隔，默认10s
+
+	RedisDatabases int `json:"redis_databases,omitempty"` // 服务端 databases 配置，用于校验 redis_db，默认16
+
+	HealthCheckInterval caddy.Duration `json:"health_check_interval,omitempty"` // 健康检查间隔，默认10s，负数关闭
+	HealthCheckFailures int            `json:"health_check_failures,omitempty"` // 连续失败多少次后重建连接，默认3
+
+	CaptureVars []string `json:"capture_vars,omitempty"` // 记录到 server.vars 中的Caddy变量名
+
+	RequestIDHeader   string `json:"request_id_header,omitempty"`   // 读取请求ID的请求头，缺失时生成UUID
+	RequestIDResponse bool   `json:"request_id_response,omitempty"` // 把请求ID写回响应头
+
+	DurationUnit string `json:"duration_unit,omitempty"` // duration 字段的单位：seconds（默认）、ms、ns
+
+	ClientIPStrategy string   `json:"client_ip_strategy,omitempty"` // 从 X-Forwarded-For 选取 client_ip 的方式：leftmost（默认）或 rightmost
+	TrustedProxies   []string `json:"trusted_proxies,omitempty"`    // 受信任代理的CIDR，选取 client_ip 时跳过
+
+	SlowThreshold caddy.Duration `json:"slow_threshold,omitempty"` // 超过该耗时的请求总是记录，并标记 slow
+
+	Transactional bool `json:"transactional,omitempty"` // 用 MULTI/EXEC 写入，避免部分命令失败
+
+	FieldMap map[string]string `json:"field_map,omitempty"` // 字段重命名，如 ts -> @timestamp
+
+	OutputSchema string `json:"output_schema,omitempty"` // 日志结构：native（默认）或 ecs
+
+	SkipHosts []string `json:"skip_hosts,omitempty"` // 不记录这些Host的请求，支持 *.internal 这样的通配符
+	OnlyHosts []string `json:"only_hosts,omitempty"` // 只记录这些Host的请求
+
+	FallbackAddress  string         `json:"fallback_address,omitempty"`  // 主Redis写入失败时改写的备用Redis
+	FallbackUsername string         `json:"fallback_username,omitempty"` // 备用Redis的用户名，未配置时沿用主Redis的认证信息
+	FallbackPassword string         `json:"fallback_password,omitempty"`
+	FailbackInterval caddy.Duration `json:"failback_interval,omitempty"` // 使用备用Redis期间重试主Redis的间隔，默认30s
+
+	LogName string `json:"log_name,omitempty"` // 本插件内部日志的logger名称后缀，用于区分多个实例
+
+	MaxEntryBytes  int    `json:"max_entry_bytes,omitempty"` // 序列化后单条日志的最大字节数
+	OversizePolicy string `json:"oversize_policy,omitempty"` // 超过 MaxEntryBytes 时的处理：truncate（默认）或 drop
+
+	UniqueIPKey string `json:"unique_ip_key,omitempty"` // 用 PFADD 把 client_ip 记入该HyperLogLog，统计独立访客
+
+	StatsKeyPrefix string         `json:"stats_key_prefix,omitempty"` // 按状态码与方法 INCR 计数器 <prefix>:status:<code>、<prefix>:method:<method>
+	StatsTTL       caddy.Duration `json:"stats_ttl,omitempty"`        // 计数器的过期时间
+
+	OutputMode string `json:"output_mode,omitempty"` // 写入方式：list（默认）、hash、stream 或 zset
+
+	CompressionAlgo string `json:"compression_algo,omitempty"` // 压缩算法：gzip（默认）或 zstd
+
+	ShutdownTimeout caddy.Duration `json:"shutdown_timeout,omitempty"` // 卸载配置时等待缓冲写完的最长时间，默认5s
+
+	RedisNetwork string `json:"redis_network,omitempty"` // tcp（默认）或 unix，redis_address 以 unix:// 开头时自动使用unix
+
+	GeoHeaders map[string]string `json:"geo_headers,omitempty"` // 请求头名 -> geo 对象中的字段名，如 CF-IPCountry -> country
+
+	ShardByMethod bool `json:"shard_by_method,omitempty"` // 按请求方法分key，在key后追加 :<method>
+
+	StartupRetries       int            `json:"startup_retries,omitempty"`        // 启动时PING失败后的重试次数
+	StartupRetryInterval caddy.Duration `json:"startup_retry_interval,omitempty"` // 第一次重试前的等待时间，之后每次翻倍，默认1s
+	SoftStart            bool           `json:"soft_start,omitempty"`             // 重试后仍连不上Redis时不让配置加载失败
+
+	WithBytesWritten bool `json:"with_bytes_written,omitempty"` // 记录包含响应头在内的 bytes_written 与 header_bytes
+
+	CheckContentLength bool `json:"check_content_length,omitempty"` // 记录响应声明的 content_length，与实际写出的 size 不一致时标记 content_length_mismatch
+
+	BodyEncoding string `json:"body_encoding,omitempty"` // 请求体与响应体的编码：utf8（默认）、base64、hex
+
+	MaxPushesPerSecond float64 `json:"max_pushes_per_second,omitempty"` // 每个key每秒最多写入的日志条数，超出的落盘或丢弃
+
+	LogErrors bool `json:"log_errors,omitempty"` // 下游handler出错时也记录日志，带上 error 字段
+
+	WithRequestLine bool `json:"with_request_line,omitempty"` // 记录原始请求行 request_line，如 GET /path HTTP/2.0
+
+	WithRequestUUID bool `json:"with_request_uuid,omitempty"` // 记录Caddy为请求分配的UUID request_uuid，与Caddy自己的访问日志关联
+
+	RedisPasswordFile string `json:"redis_password_file,omitempty"` // 从文件读取Redis密码，优先于 redis_password
+
+	Dedupe       bool           `json:"dedupe,omitempty"`        // 合并窗口内相同的日志，只写一条并带上 count
+	DedupeWindow caddy.Duration `json:"dedupe_window,omitempty"` // 去重窗口，默认1s，日志会晚这么久写入
+	DedupeFields []string       `json:"dedupe_fields,omitempty"` // 判断日志是否相同的字段，如 request.uri、status
+
+	WithReceivedAt bool `json:"with_received_at,omitempty"` // 记录请求到达的时间 received_at，格式同 ts
+
+	SanitizeControlChars bool `json:"sanitize_control_chars,omitempty"` // 把URI、请求头、请求体等中的控制字符转义为 \r、\n、\xNN
+
+	MaxConcurrentBodyCaptures int `json:"max_concurrent_body_captures,omitempty"` // 同时捕获请求体、响应体的最大请求数，超出时不记录body并标记 body_skipped，0表示不限制
+
+	// 在序列化之前依次调用的日志转换模块，见 LogTransformer
+	TransformersRaw []json.RawMessage `json:"transformers,omitempty" caddy:"namespace=http.handlers.redis_logger.transformers inline_key=transformer"`
+
+	PushRetries      int            `json:"push_retries,omitempty"`       // 写入失败后的重试次数，之后再按 on_error 处理
+	PushRetryBackoff caddy.Duration `json:"push_retry_backoff,omitempty"` // 第一次重试前的等待时间，之后每次翻倍，默认100ms
+
+	KeyPrefix string `json:"key_prefix,omitempty"` // 加在所有写入的key前面，包括统计key，如 prod: 或 staging:
+
+	WithQuery bool `json:"with_query,omitempty"` // 把查询参数解析为 request.query 对象，每个参数的值都是数组
+
+	WithCookies bool `json:"with_cookies,omitempty"` // 把Cookie头解析为 request.cookies 对象（名称->值）
+
+	MaxHeaders int `json:"max_headers,omitempty"` // 请求头、响应头各自最多记录的个数，按名称排序取前N个，超出时标记 headers_truncated
+
+	UseScript bool `json:"use_script,omitempty"` // 用Lua脚本（EVALSHA）原子地执行 LPUSH、LTRIM 与 EXPIRE
+
+	ClientName string `json:"client_name,omitempty"` // 连接名，通过 CLIENT SETNAME 设置，默认 caddy:<主机名>，设为 - 表示不设置
+
+	ResponseBodyStatus []string `json:"response_body_status,omitempty"` // 只记录这些状态码的响应体，如 400-599
+	ResponseBodyTypes  []string `json:"response_body_types,omitempty"`  // 只记录这些 Content-Type（前缀匹配）的响应体，如 application/json、text/
+
+	Fingerprint []string `json:"fingerprint,omitempty"` // 计算请求指纹的属性，为Caddy占位符，如 {http.request.method}、{http.request.header.User-Agent}
+
+	StreamFields bool `json:"stream_fields,omitempty"` // stream 模式下把日志展开为多个field，而不是一个 data 字段
+
+	BodyContentTypes []string `json:"body_content_types,omitempty"` // 只记录这些 Content-Type（前缀匹配）的请求体，如 application/json，为空时全部记录
+
+	ReliableQueue bool   `json:"reliable_queue,omitempty"` // 按可靠队列模式写入：RPUSH 到队尾，禁止裁剪与过期
+	ProcessingKey string `json:"processing_key,omitempty"` // 消费者的处理中列表，加载配置时把其中残留的日志放回队列
+
+	TrimInterval caddy.Duration `json:"trim_interval,omitempty"` // 设置后由后台协程每隔这么久把列表裁到 max_len，写入时不再 LTRIM
+
+	EnvelopeType    string `json:"envelope_type,omitempty"`    // 设置后把日志包装为 {"type":...,"version":...,"payload":{...}} 再序列化
+	EnvelopeVersion int    `json:"envelope_version,omitempty"` // 信封中的 version
+
+	Metadata map[string]string `json:"metadata,omitempty"` // 附加到每条日志 meta 对象中的静态字段，如机房、应用版本，值支持Caddy全局占位符
+
+	MaxInFlight  int            `json:"max_in_flight,omitempty"`  // 同时进行的同步写入的上限，0表示不限制
+	FullPolicy   string         `json:"full_policy,omitempty"`    // 达到 MaxInFlight 时的处理：drop（默认）或 wait
+	InFlightWait caddy.Duration `json:"in_flight_wait,omitempty"` // wait 策略的最长等待时间，超时后丢弃，默认1s
+
+	WithAuthPresent bool     `json:"with_auth_present,omitempty"` // 记录请求是否带有凭据 auth_present，凭据的值总是打码
+	AuthCookies     []string `json:"auth_cookies,omitempty"`      // 视为凭据的会话cookie名称
+
+	client             *liveClient
+	meta               map[string]string
+	logger             *zap.Logger
+	keys               []string
+	timeKeys           []*timeKey
+	keyHasPlaceholders bool
+	now                func() time.Time // 展开时间key、记录 ts 与备用Redis切回计时使用的时钟，默认 time.Now，测试中替换为假时钟
+	buffer             *logBuffer
+	headerInclude      map[string]struct{}
+	headerExclude      map[string]struct{}
+	redactHeaderSet    map[string]struct{}
+	redactParamSet     map[string]struct{}
+	statusRanges       []statusRange
+	respBodyStatus     []statusRange
+	skipPaths          caddyhttp.MatchPath
+	skipMethods        caddyhttp.MatchMethod
+	fieldSet           map[string]struct{}
+	metrics            *loggerMetrics
+	spill              *spillFile
+	fastPath           bool
+	bodySlots          chan struct{}
+	inFlight           chan struct{}
+	limiters           *keyLimiters
+	dedupe             *deduper
+	trimmer            *trimmer
+	transformers       []LogTransformer
+	trustedProxies     []netip.Prefix
+	skipHosts          caddyhttp.MatchHost
+	fallback           *fallbackState
+	onlyHosts          caddyhttp.MatchHost
+
+	// 后台裁剪使用的定时器，默认 realTimer，测试中替换为手动触发的定时器
+	newTimer func(time.Duration) (<-chan time.Time, func() bool)
 }
 
 // Provision实现了caddy.Provisioner
 func (rl *RedisLogger) Provision(ctx caddy.Context) error {
 	rl.logger = ctx.Logger(rl)
+	rl.metrics = newLoggerMetrics(rl.RedisKey)
+
+	if rl.now == nil {
+		rl.now = time.Now
+	}
+	if rl.newTimer == nil {
+		rl.newTimer = realTimer
+	}
+	rl.keys = append([]string{rl.RedisKey}, rl.RedisKeys...)
+	for i, key := range rl.keys {
+		if hasPlaceholders(key) {
+			rl.keyHasPlaceholders = true
+		}
+		if hasTimeVerbs(key) {
+			if rl.timeKeys == nil {
+				rl.timeKeys = make([]*timeKey, len(rl.keys))
+			}
+			rl.timeKeys[i] = &timeKey{template: key}
+		}
+	}
+	rl.headerInclude = headerSet(rl.HeaderInclude)
+	rl.headerExclude = headerSet(rl.HeaderExclude)
+	redact := append(append([]string(nil), rl.Redact...), rl.authRedactions()...)
+	rl.redactHeaderSet = headerSet(redact)
+	rl.redactParamSet = redactParams(redact)
+
+	if err := validateFormat(rl.Format); err != nil {
+		return err
+	}
+	if err := validateOnError(rl.OnError); err != nil {
+		return err
+	}
+	if err := validateDurationUnit(rl.DurationUnit); err != nil {
+		return err
+	}
+	if err := validateOutputSchema(rl.OutputSchema); err != nil {
+		return err
+	}
+	if err := validateOversizePolicy(rl.OversizePolicy); err != nil {
+		return err
+	}
+	if err := validateOutputMode(rl.OutputMode); err != nil {
+		return err
+	}
+	if err := validateCompressionAlgo(rl.CompressionAlgo); err != nil {
+		return err
+	}
+	if err := validateBodyEncoding(rl.BodyEncoding); err != nil {
+		return err
+	}
+	rl.fastPath = rl.fastPathEnabled()
+	if err := validateClientIPStrategy(rl.ClientIPStrategy); err != nil {
+		return err
+	}
+	trustedProxies, err := parseTrustedProxies(rl.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	rl.trustedProxies = trustedProxies
+
+	if rl.SampleRate < 0 || rl.SampleRate > 1 {
+		return fmt.Errorf("sample_rate must be between 0 and 1, got %v", rl.SampleRate)
+	}
+
+	statusRanges, err := parseStatusRanges("log_status", rl.LogStatus)
+	if err != nil {
+		return err
+	}
+	rl.statusRanges = statusRanges
+	if rl.respBodyStatus, err = parseStatusRanges("response_body_status", rl.ResponseBodyStatus); err != nil {
+		return err
+	}
+
+	if err := rl.provisionSkipMatchers(ctx); err != nil {
+		return err
+	}
+
+	rl.meta = resolveMetadata(rl.Metadata)
+
+	if len(rl.Fields) > 0 {
+		rl.fieldSet = make(map[string]struct{}, len(rl.Fields))
+		for _, field := range rl.Fields {
+			rl.fieldSet[field] = struct{}{}
+		}
+	}
+
+	if rl.DialTimeout < 0 || rl.ReadTimeout < 0 || rl.WriteTimeout < 0 {
+		return fmt.Errorf("dial_timeout, read_timeout and write_timeout cannot be negative")
+	}
+	if rl.MaxRetries < 0 {
+		return fmt.Errorf("max_retries cannot be negative")
+	}
+	if rl.MaxConcurrentBodyCaptures < 0 {
+		return fmt.Errorf("max_concurrent_body_captures cannot be negative")
+	}
+	if rl.MaxConcurrentBodyCaptures > 0 {
+		rl.bodySlots = make(chan struct{}, rl.MaxConcurrentBodyCaptures)
+	}
+	if err := rl.loadTransformers(ctx); err != nil {
+		return fmt.Errorf("loading transformers: %w", err)
+	}
+	if rl.Dedupe {
+		rl.dedupe = newDeduper(time.Duration(rl.DedupeWindow), rl.DedupeFields)
+	}
+	if err := rl.validateReliableQueue(); err != nil {
+		return err
+	}
+	if len(rl.AuthCookies) > 0 && !rl.WithAuthPresent {
+		return fmt.Errorf("auth_cookies requires with_auth_present")
+	}
+	if err := rl.validateZset(); err != nil {
+		return err
+	}
+	if err := rl.validateEnvelope(); err != nil {
+		return err
+	}
+	if err := rl.validateTransactional(); err != nil {
+		return err
+	}
+	if rl.StreamFields && rl.OutputMode != outputStream {
+		return fmt.Errorf("stream_fields requires output_mode stream")
+	}
+	if rl.MaxHeaders < 0 {
+		return fmt.Errorf("max_headers cannot be negative")
+	}
+	if rl.PushRetries < 0 {
+		return fmt.Errorf("push_retries cannot be negative")
+	}
+	if rl.MaxPushesPerSecond < 0 {
+		return fmt.Errorf("max_pushes_per_second cannot be negative")
+	}
+	if rl.MaxPushesPerSecond > 0 {
+		rl.limiters = newKeyLimiters(rl.MaxPushesPerSecond)
+	}
+	if err := validateFullPolicy(rl.FullPolicy); err != nil {
+		return err
+	}
+	if rl.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight cannot be negative")
+	}
+	if rl.MaxInFlight > 0 {
+		rl.inFlight = make(chan struct{}, rl.MaxInFlight)
+	}
+	if rl.InFlightWait == 0 {
+		rl.InFlightWait = caddy.Duration(defaultInFlightWait)
+	}
+	if rl.StartupRetries < 0 {
+		return fmt.Errorf("startup_retries cannot be negative")
+	}
+	if rl.RedisDatabases == 0 {
+		rl.RedisDatabases = defaultRedisDatabases
+	}
+	if db := rl.db(); db < 0 || db >= rl.RedisDatabases {
+		return fmt.Errorf("redis_db must be between 0 and %d, got %d", rl.RedisDatabases-1, db)
+	}
+	if rl.RedisDB != nil && *rl.RedisDB != 0 && len(rl.ClusterAddrs) > 0 {
+		return fmt.Errorf("redis_db %d cannot be used with cluster_addrs, Redis Cluster only supports DB 0", *rl.RedisDB)
+	}
 
 	// 设置默认配置
-	if rl.RedisAddress == "" {
+	if rl.RedisAddress == "" && rl.RedisURL == "" {
 		rl.RedisAddress = "localhost:6379"
 	}
-	if rl.RedisDB == 0 {
-		rl.RedisDB = 0
+
+	if err := rl.resolveCredentials(); err != nil {
+		return err
 	}
+	if err := rl.validateNetwork(); err != nil {
+		return err
+	}
+
+	rl.logger = rl.instanceLogger(rl.logger)
 	if rl.DialTimeout == 0 {
 		rl.DialTimeout = 5 * time.Second // 默认连接超时时间
 	}
@@ -51,35 +431,87 @@ func (rl *RedisLogger) Provision(ctx caddy.Context) error {
 	if rl.MaxRetries == 0 {
 		rl.MaxRetries = 3 // 默认最大重试次数
 	}
+	if rl.MaxBodySize == 0 {
+		rl.MaxBodySize = defaultMaxBodySize
+	}
+	if rl.MaxResponseBodySize == 0 {
+		rl.MaxResponseBodySize = defaultMaxResponseBodySize
+	}
+	if rl.CompressThreshold == 0 {
+		rl.CompressThreshold = defaultCompressThreshold
+	}
 
-	rl.client = redis.NewClient(&redis.Options{
-		Addr:         rl.RedisAddress,
-		Password:     rl.RedisPassword,
-		DB:           rl.RedisDB,
-		DialTimeout:  rl.DialTimeout,
-		ReadTimeout:  rl.ReadTimeout,
-		WriteTimeout: rl.WriteTimeout,
-		MaxRetries:   rl.MaxRetries,
-	})
+	switch rl.ClientName {
+	case "":
+		rl.ClientName = defaultClientName()
+	case "-":
+		rl.ClientName = ""
+	}
+	client, poolKey, err := rl.sharedClient()
+	if err != nil {
+		return fmt.Errorf("configuring Redis client: %w", err)
+	}
+	rl.client = &liveClient{client: client, poolKey: poolKey}
+	if rl.FallbackAddress != "" {
+		if rl.FailbackInterval <= 0 {
+			rl.FailbackInterval = caddy.Duration(defaultFailbackInterval)
+		}
+		rl.fallback = &fallbackState{}
+	}
 
-	// Use context for the Ping command
-	// ctx := context.Background()
-	_, err := rl.client.Ping(ctx).Result()
+	err = rl.waitForRedis(ctx, client)
+	rl.client.recordPing(err)
 	if err != nil {
-		rl.logger.Error("Failed to connect to Redis", zap.Error(err))
-		return fmt.Errorf("could not connect to Redis: %w", err)
+		if !rl.SoftStart {
+			rl.logger.Error("Failed to connect to Redis", zap.Error(err))
+			return fmt.Errorf("could not connect to Redis: %w", err)
+		}
+		// 客户端会在写入时再建立连接，健康检查也会在后台重建客户端
+		rl.logger.Warn("Redis not reachable yet, continuing because soft_start is enabled", zap.Error(err))
+	} else {
+		rl.logger.Info("Successfully connected to Redis", zap.Strings("redis_keys", rl.keys))
+		if err := rl.requeueProcessing(ctx, client); err != nil {
+			rl.logger.Error("Error requeueing unacknowledged entries", zap.Error(err))
+		}
 	}
 
-	rl.logger.Info("Successfully connected to Redis",
+	if rl.SpillDir != "" {
+		if err := rl.startSpill(); err != nil {
+			return err
+		}
+	}
+	if rl.BufferSize > 0 {
+		rl.startBuffer()
+	}
+	rl.startHealthCheck()
+	rl.startTrimmer()
+	registerInstance(rl)
+	return nil
+}
+
+// instanceLogger 按 LogName 命名内部日志。同一个Caddy里可能有多个 redis_logger，
+// 每条内部日志都带上key与地址以便区分
+func (rl *RedisLogger) instanceLogger(logger *zap.Logger) *zap.Logger {
+	if rl.LogName != "" {
+		logger = logger.Named(rl.LogName)
+	}
+	return logger.With(
 		zap.String("redis_key", rl.RedisKey),
-		zap.String("redis_address", rl.RedisAddress),
+		zap.String("redis_address", rl.displayAddress()),
 	)
-	return nil
 }
 
 // Validate实现了caddy.Validator
 func (rl *RedisLogger) Validate() error {
-	if rl.client == nil {
+	if strings.TrimSpace(rl.RedisKey) == "" {
+		return fmt.Errorf("redis_key is required")
+	}
+	for _, key := range rl.RedisKeys {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("redis_keys cannot contain an empty key")
+		}
+	}
+	if rl.client == nil || rl.client.get() == nil {
 		return fmt.Errorf("no redis connet")
 	}
 	return nil
@@ -87,71 +519,260 @@ func (rl *RedisLogger) Validate() error {
 
 // ServeHTTP 实现了 caddyhttp.MiddlewareHandler
 func (rl *RedisLogger) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if rl.skipRequest(r) {
+		return next.ServeHTTP(w, r)
+	}
+
 	start := time.Now()
-	recorder := caddyhttp.NewResponseRecorder(w, nil, nil)
-
-	if err := next.ServeHTTP(recorder, r); err != nil {
-		rl.logger.Error("Error next ServeHTTP", zap.Error(err))
-		return err
-	}
-
-	duration := time.Since(start).Seconds()
-	logEntry := map[string]interface{}{
-		// "level":  "info",
-		"ts": time.Now().Format(time.RFC3339Nano),
-		// "logger": "http.log.access.log0",
-		// "msg":    "handled request",
-		"request": map[string]interface{}{
-			"remote_ip":   r.RemoteAddr,
-			"remote_port": r.URL.Port(),
-			"client_ip":   r.Header.Get("X-Forwarded-For"),
-			"proto":       r.Proto,
-			"method":      r.Method,
-			"host":        r.Host,
-			"uri":         r.RequestURI,
-			"headers":     r.Header,
-			"tls": map[string]interface{}{
-				"resumed":      r.TLS.DidResume,
-				"version":      r.TLS.Version,
-				"cipher_suite": r.TLS.CipherSuite,
-				"proto":        r.TLS.NegotiatedProtocol,
-				"server_name":  r.TLS.ServerName,
-			},
-		},
-		"bytes_read": r.ContentLength,
-		// "user_id":      "", // 可以根据需求设置用户ID
-		"duration":     duration,
-		"size":         recorder.Size(),
-		"status":       recorder.Status(),
-		"resp_headers": recorder.Header(),
-	}
-
-	if rl.WithBody {
+	requestID := rl.requestID(w, r)
+
+	// 并发捕获请求体、响应体的请求数超过 MaxConcurrentBodyCaptures 时，本次请求不记录请求体与响应体
+	withBody, withResponseBody := rl.WithBody, rl.WithResponseBody
+	if withBody && len(rl.BodyContentTypes) > 0 {
+		withBody = contentTypeMatches(r.Header.Get("Content-Type"), rl.BodyContentTypes)
+	}
+	bodySkipped := false
+	if withBody || withResponseBody {
+		if release, ok := rl.acquireBodySlot(); ok {
+			defer release()
+		} else {
+			withBody, withResponseBody, bodySkipped = false, false, true
+		}
+	}
+
+	// 只有需要记录响应体时才在写给客户端的同时复制响应体，响应从不被缓冲
+	var capture *responseCapture
+	out := w
+	if withResponseBody {
+		capture = rl.newResponseCapture(w)
+		out = capture
+	}
+	recorder := caddyhttp.NewResponseRecorder(out, nil, nil)
+
+	// 下游handler会消费请求体，必须在调用之前预读
+	// 读取失败时照常处理请求，日志中记录已读到的部分与错误
+	var body *capturedBody
+	if withBody {
+		body = captureRequestBody(r, rl.MaxBodySize)
+		if body.err != nil {
+			rl.logger.Warn("Error reading request body", zap.Error(body.err))
+		}
+	}
+
+	// 开启 LogErrors 时下游出错的请求也记录，记录后再把错误返回给Caddy
+	status := 0
+	handlerErr := next.ServeHTTP(recorder, r)
+	if handlerErr != nil {
+		rl.logger.Error("Error next ServeHTTP", zap.Error(handlerErr))
+		if !rl.LogErrors {
+			return handlerErr
+		}
+		status = errorStatus(handlerErr)
+	}
+
+	if recorder.Status() != 0 {
+		status = recorder.Status()
+	}
+
+	// 慢请求不受状态码过滤与采样的影响，总是记录
+	elapsed := time.Since(start)
+	slow := rl.SlowThreshold > 0 && elapsed >= time.Duration(rl.SlowThreshold)
+	if !slow {
+		if !rl.statusLogged(status) {
+			return handlerErr
+		}
+		if !rl.sampled(status) {
+			rl.metrics.drop(dropReasonSampled)
+			return handlerErr
+		}
+	}
+
+	duration := rl.formatDuration(elapsed)
+	remoteIP, remotePort := splitRemoteAddr(r.RemoteAddr)
+	clientIP := rl.clientIP(r, remoteIP)
+	reqHeaders, reqTruncated := rl.limitHeaders(rl.filterHeaders(r.Header))
+	reqHeaders = rl.redactHeaders(reqHeaders)
+	respHeaders, respTruncated := rl.limitHeaders(recorder.Header())
+	entry := getEntry()
+	defer putEntry(entry)
+	// "level": "info", "logger": "http.log.access.log0", "msg": "handled request"
+	entry.at = rl.now()
+	entry.Ts = rl.formatTime(entry.at)
+	if rl.WithReceivedAt {
+		entry.ReceivedAt = rl.formatTime(start)
+	}
+	entry.Request = accessRequest{
+		RemoteIP:   remoteIP,
+		RemotePort: remotePort,
+		Scheme:     rl.scheme(r, remoteIP),
+		ClientIP:   clientIP,
+		Proto:      r.Proto,
+		Method:     r.Method,
+		Host:       r.Host,
+		URI:        rl.redactURI(r.RequestURI),
+		Headers:    reqHeaders,
+		TLS:        newAccessTLS(r.TLS),
+	}
+	if rl.WithRequestLine {
+		entry.RequestLine = r.Method + " " + entry.Request.URI + " " + r.Proto
+	}
+	if rl.WithAuthPresent {
+		authPresent := rl.authPresent(r)
+		entry.AuthPresent = &authPresent
+	}
+	if rl.WithRequestUUID {
+		entry.RequestUUID = requestUUID(r)
+	}
+	if rl.WithCookies {
+		entry.Request.Cookies = rl.cookies(r)
+	}
+	if rl.WithQuery {
+		if query := r.URL.Query(); len(query) > 0 {
+			entry.Request.Query = rl.redactQuery(query)
+		}
+	}
+	entry.BytesRead = r.ContentLength
+	// user_id 可以根据需求设置用户ID
+	entry.Duration = duration
+	entry.Size = recorder.Size()
+	entry.Status = status
+	if handlerErr != nil {
+		entry.Error = handlerErr.Error()
+	}
+	entry.RespHeaders = rl.redactHeaders(respHeaders)
+	entry.HeadersTruncated = reqTruncated || respTruncated
+	entry.Server = rl.serverInfo(r)
+	entry.Slow = slow
+	entry.BodySkipped = bodySkipped
+	entry.RequestID = requestID
+	entry.Upstream = upstreamAddr(r)
+	entry.Geo = rl.geoInfo(r)
+	entry.Meta = rl.meta
+	entry.Fingerprint = rl.fingerprint(r)
+	if rl.WithBytesWritten {
+		entry.HeaderBytes = headerBytes(r.Proto, statusOrOK(status), recorder.Header())
+		entry.BytesWritten = entry.HeaderBytes + int64(recorder.Size())
+	}
+	if rl.CheckContentLength {
+		if declared := declaredContentLength(r.Method, statusOrOK(status), recorder.Header()); declared >= 0 {
+			entry.ContentLength = &declared
+			entry.ContentLengthMismatch = declared != int64(recorder.Size())
+		}
+	}
+
+	if body != nil {
 		// https://github.com/caddyserver/caddy/commit/6f0f159ba56adeb6e2cbbb408651419b87f20856
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			rl.logger.Error("Error reading request body", zap.Error(err))
-			return err
+		body.decompress(r.Header.Get("Content-Encoding"), rl.MaxBodySize)
+		reqBody := rl.encodeBody(body.data)
+		entry.RequestBody = &reqBody
+		entry.RequestBodyTruncated = body.truncated
+		if body.err != nil {
+			entry.RequestBodyError = body.err.Error()
 		}
-		logEntry["request_body"] = string(body)
 	}
 
-	logJSON, err := json.Marshal(logEntry)
-	if err != nil {
-		rl.logger.Error("Error marshaling log entry to JSON", zap.Error(err))
-		return err
+	if handlerErr == nil && capture != nil {
+		if data, truncated, ok := capture.body(); ok {
+			respBody := rl.encodeBody(data)
+			entry.ResponseBody = &respBody
+			entry.ResponseBodyTruncated = truncated
+		}
 	}
 
-	ctx := context.Background()
-	if err := rl.client.LPush(ctx, rl.RedisKey, logJSON).Err(); err != nil {
-		rl.logger.Error("Error pushing log entry to Redis", zap.Error(err))
-	} else { //!TEST
-		rl.logger.Info("Successfully pushed log entry to Redis", zap.String("key", rl.RedisKey))
+	if rl.SanitizeControlChars {
+		entry.sanitize()
 	}
 
-	return nil
+	keys := rl.redisKeys(r, status)
+	if len(keys) == 0 {
+		rl.metrics.drop(dropReasonEmptyKey)
+		return handlerErr
+	}
+	var stats *requestStats
+	if rl.UniqueIPKey != "" || rl.StatsKeyPrefix != "" {
+		stats = &requestStats{
+			clientIP: clientIP,
+			status:   statusOrOK(status),
+			method:   r.Method,
+		}
+	}
+	if rl.dedupe != nil && rl.dedupe.hold(rl, entry, keys, elapsed, stats) {
+		return handlerErr
+	}
+	if err := rl.emit(entry, keys, elapsed, stats); handlerErr == nil {
+		return err
+	}
+	return handlerErr
 }
 
+// emit 序列化日志并写入各个key，stats 附带在第一个key上
+func (rl *RedisLogger) emit(entry *accessEntry, keys []string, elapsed time.Duration, stats *requestStats) error {
+	items := make([]logItem, len(keys))
+	switch {
+	case rl.OutputMode == outputHash:
+		// 每个请求一个hash，key 为 <redis_key>:<请求ID>
+		id := entry.RequestID
+		if id == "" {
+			id = uuid.NewString()
+		}
+		fields := hashFields(rl.transform(rl.entryMap(entry), elapsed))
+		for i, key := range keys {
+			items[i] = logItem{key: key + ":" + id, hash: fields, base: key}
+		}
+	case rl.OutputMode == outputStream && rl.StreamFields:
+		// 每个字段作为stream消息中单独的field
+		fields := hashFields(rl.transform(rl.entryMap(entry), elapsed))
+		for i, key := range keys {
+			items[i] = logItem{key: key, hash: fields, stream: true}
+		}
+	default:
+		data, err := rl.serialize(entry, elapsed)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			return nil
+		}
+		stream := rl.OutputMode == outputStream
+		zset := rl.OutputMode == outputZset
+		// score 是double，纳秒数超出了它能精确表示的整数范围（2^53），微秒数可以精确保存
+		score := float64(entry.at.UnixMicro())
+		for i, key := range keys {
+			items[i] = logItem{key: key, value: data, stream: stream, zset: zset, score: score}
+		}
+	}
+	items[0].stats = stats
+	return rl.send(items)
+}
+
+// Cleanup 先在 ShutdownTimeout 内写完缓冲中的日志再关闭连接，超时也会关闭连接并返回错误
 func (rl *RedisLogger) Cleanup() error {
-	return rl.client.Close()
+	unregisterInstance(rl)
+	// 暂存的日志要在缓冲队列关闭前写入
+	if rl.dedupe != nil {
+		rl.dedupe.flush(rl)
+	}
+	var err error
+	if rl.buffer != nil {
+		if err = rl.buffer.stop(time.Duration(rl.ShutdownTimeout)); err != nil {
+			rl.logger.Error("Error draining log buffer", zap.Error(err))
+		}
+	}
+	if rl.spill != nil {
+		rl.spill.close()
+	}
+	if rl.client == nil {
+		return err
+	}
+	rl.client.stopHealthCheck()
+	if rl.trimmer != nil {
+		rl.trimmer.stopTrimmer()
+	}
+	if rl.fallback != nil {
+		rl.fallback.close()
+	}
+	if closeErr := rl.client.close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
@@ -0,0 +1,172 @@
+package redislogger
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/go-redis/redis/v8"
+)
+
+// provisioned 记录已经Provision、尚未Cleanup的实例，Caddy对每个实例只调用一次Cleanup
+var provisioned sync.Map
+
+// provision 用测试用的Caddy上下文执行Provision，测试结束时执行Cleanup
+func provision(t testing.TB, rl *RedisLogger) error {
+	t.Helper()
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	if err := rl.Provision(ctx); err != nil {
+		return err
+	}
+	provisioned.Store(rl, struct{}{})
+	t.Cleanup(func() { cleanup(rl) })
+	return nil
+}
+
+// cleanup 执行 rl 的Cleanup，测试中提前调用后结束时不会再调用一次
+func cleanup(rl *RedisLogger) error {
+	if _, ok := provisioned.LoadAndDelete(rl); !ok {
+		return nil
+	}
+	return rl.Cleanup()
+}
+
+// waitFor 轮询直到 cond 成立，超时后测试失败
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// listLen 返回列表的长度，key不存在时为0
+func listLen(mr *miniredis.Miniredis, key string) int {
+	values, _ := mr.List(key)
+	return len(values)
+}
+
+// newTestLogger 创建写入 mr 的 RedisLogger，key 为 access，configure 在Provision之前修改配置
+func newTestLogger(t testing.TB, mr *miniredis.Miniredis, configure func(rl *RedisLogger)) *RedisLogger {
+	t.Helper()
+	rl := &RedisLogger{RedisKey: "access", RedisAddress: mr.Addr()}
+	if configure != nil {
+		configure(rl)
+	}
+	if err := provision(t, rl); err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	return rl
+}
+
+// newTestRequest 创建带有Caddy请求上下文（replacer与vars）的请求
+func newTestRequest(method, target string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	ctx := context.WithValue(r.Context(), caddyhttp.VarsCtxKey, map[string]any{})
+	r = r.WithContext(ctx)
+	caddyhttp.NewTestReplacer(r)
+	return r
+}
+
+// respond 返回写出固定状态码、Content-Type与响应体的下游handler，status 为0时不写响应头
+func respond(status int, contentType, body string) caddyhttp.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+		if body == "" {
+			return nil
+		}
+		_, err := io.WriteString(w, body)
+		return err
+	}
+}
+
+// serve 让 rl 处理请求，下游handler为 next，返回客户端收到的响应
+func serve(t testing.TB, rl *RedisLogger, r *http.Request, next caddyhttp.Handler) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := rl.ServeHTTP(w, r, next); err != nil {
+		t.Fatalf("ServeHTTP: %v", err)
+	}
+	return w
+}
+
+// entries 取出列表中的全部日志并解析，LPUSH写入，最新的在前
+func entries(t testing.TB, mr *miniredis.Miniredis, key string) []map[string]any {
+	t.Helper()
+	values, err := mr.List(key)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	out := make([]map[string]any, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal([]byte(value), &out[i]); err != nil {
+			t.Fatalf("decoding entry %q: %v", value, err)
+		}
+	}
+	return out
+}
+
+// lastEntry 返回列表中最新的一条日志，列表必须恰好有一条
+func lastEntry(t testing.TB, mr *miniredis.Miniredis, key string) map[string]any {
+	t.Helper()
+	all := entries(t, mr, key)
+	if len(all) != 1 {
+		t.Fatalf("expected 1 entry in %s, got %d", key, len(all))
+	}
+	return all[0]
+}
+
+func TestServeHTTPPushesEntry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, nil)
+
+	serve(t, rl, newTestRequest("GET", "/hello?x=1", nil), respond(200, "text/plain", "hi"))
+
+	entry := lastEntry(t, mr, "access")
+	request := entry["request"].(map[string]any)
+	if request["method"] != "GET" || request["uri"] != "/hello?x=1" {
+		t.Errorf("unexpected request %v", request)
+	}
+	if entry["status"] != float64(200) || entry["size"] != float64(2) {
+		t.Errorf("unexpected status/size in %v", entry)
+	}
+}
+
+func TestClusterClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisAddress = ""
+		rl.ClusterAddrs = []string{mr.Addr()}
+	})
+	if _, ok := rl.client.get().(*redis.ClusterClient); !ok {
+		t.Fatalf("expected a cluster client, got %T", rl.client.get())
+	}
+
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(204, "", ""))
+	lastEntry(t, mr, "access")
+}
+
+func TestClusterRejectsDB(t *testing.T) {
+	db := 1
+	rl := &RedisLogger{RedisKey: "access", ClusterAddrs: []string{"127.0.0.1:1"}, RedisDB: &db}
+	if err := provision(t, rl); err == nil {
+		t.Fatal("expected redis_db with cluster_addrs to be rejected")
+	}
+}
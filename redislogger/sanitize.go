@@ -0,0 +1,74 @@
+package redislogger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// sanitizeString 把控制字符转义为可见的 \r、\n、\t 或 \xNN，
+// 避免注入的换行等字符破坏下游按行解析的日志处理程序
+func sanitizeString(s string) string {
+	if strings.IndexFunc(s, unicode.IsControl) < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for _, r := range s {
+		switch {
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sanitizeHeader 返回转义后的请求头副本，不修改原始请求头
+func sanitizeHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		clean := make([]string, len(values))
+		for i, v := range values {
+			clean[i] = sanitizeString(v)
+		}
+		out[sanitizeString(name)] = clean
+	}
+	return out
+}
+
+// sanitize 转义日志中来自客户端或上游的字符串：URI、Host、请求行、请求头、响应头与请求体、响应体
+func (e *accessEntry) sanitize() {
+	e.Request.URI = sanitizeString(e.Request.URI)
+	e.Request.Host = sanitizeString(e.Request.Host)
+	e.Request.Headers = sanitizeHeader(e.Request.Headers)
+	for name, value := range e.Request.Cookies {
+		e.Request.Cookies[name] = sanitizeString(value)
+	}
+	if e.Request.Query != nil {
+		e.Request.Query = url.Values(sanitizeHeader(http.Header(e.Request.Query)))
+	}
+	e.RespHeaders = sanitizeHeader(e.RespHeaders)
+	e.RequestLine = sanitizeString(e.RequestLine)
+	e.Error = sanitizeString(e.Error)
+	if e.RequestBody != nil {
+		body := sanitizeString(*e.RequestBody)
+		e.RequestBody = &body
+	}
+	if e.ResponseBody != nil {
+		body := sanitizeString(*e.ResponseBody)
+		e.ResponseBody = &body
+	}
+}
@@ -0,0 +1,68 @@
+package redislogger
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// pushScript 在Redis端原子地完成一条日志的 LPUSH、LTRIM 与 PEXPIRE。
+// KEYS[1] 为列表key；ARGV[1] 为日志，ARGV[2] 为 max_len，ARGV[3] 为过期毫秒数，0表示不裁剪/不过期。
+var pushScript = redis.NewScript(`
+local n = redis.call('LPUSH', KEYS[1], ARGV[1])
+local maxlen = tonumber(ARGV[2])
+if maxlen > 0 then
+	redis.call('LTRIM', KEYS[1], 0, maxlen - 1)
+end
+local ttl = tonumber(ARGV[3])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return n
+`)
+
+// scriptPush 在pipeline中用 EVALSHA 写入一条日志
+func (rl *RedisLogger) scriptPush(ctx context.Context, pipe redis.Pipeliner, item logItem) {
+	ttl := time.Duration(rl.KeyTTL).Milliseconds()
+	pushScript.EvalSha(ctx, pipe, []string{item.key}, item.value, rl.MaxLen, ttl)
+}
+
+// isNoScript 判断错误是否为脚本未加载（Redis重启、SCRIPT FLUSH 或切换到新节点之后）
+func isNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
+
+// retryNoScript 在pipeline只因 NOSCRIPT 失败时，用 EVAL 重新执行这些 EVALSHA，
+// Redis 会同时缓存脚本，之后的 EVALSHA 就能命中。还有其他错误时返回原始错误。
+func (rl *RedisLogger) retryNoScript(ctx context.Context, client redisClient, cmds []redis.Cmder, err error) error {
+	var retry [][]interface{}
+	for _, cmd := range cmds {
+		cmdErr := cmd.Err()
+		if cmdErr == nil {
+			continue
+		}
+		if !isNoScript(cmdErr) {
+			return err
+		}
+		// evalsha <sha> 1 <key> <value> <max_len> <ttl>
+		retry = append(retry, cmd.Args()[3:])
+	}
+	if len(retry) == 0 {
+		return err
+	}
+
+	_, err = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, args := range retry {
+			key, ok := args[0].(string)
+			if !ok {
+				return errors.New("unexpected EVALSHA arguments")
+			}
+			pushScript.Eval(ctx, pipe, []string{key}, args[1:]...)
+		}
+		return nil
+	})
+	return err
+}
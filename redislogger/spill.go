@@ -0,0 +1,288 @@
+package redislogger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// 落盘缓冲的默认参数
+const (
+	defaultSpillMaxBytes      = 100 << 20
+	defaultSpillRetryInterval = 10 * time.Second
+	spillReplayBatchSize      = 100
+)
+
+// spilledItem 是落盘文件中的一行，value 可能是msgpack或压缩后的二进制，JSON编码时会转为base64
+type spilledItem struct {
+	Key    string            `json:"key"`
+	Value  []byte            `json:"value"`
+	Hash   map[string]string `json:"hash,omitempty"`
+	Stream bool              `json:"stream,omitempty"`
+	Zset   bool              `json:"zset,omitempty"`
+	Score  float64           `json:"score,omitempty"`
+	Base   string            `json:"base,omitempty"`
+}
+
+// spillPool 让同一个落盘文件只有一个 spillStore：key相同的实例，以及重载配置时
+// 同时存在的新旧实例都会用到同一个文件，必须共用同一把锁
+var spillPool = caddy.NewUsagePool()
+
+// spillStore 是一个落盘文件，由所有使用它的实例共享
+type spillStore struct {
+	mu       sync.Mutex // 保护文件内容与 size
+	replayMu sync.Mutex // 同一时间只有一个实例在重放
+	path     string
+	size     int64
+	max      int64
+}
+
+// Destruct 满足 caddy.Destructor，文件保留在磁盘上，下次启动时重放
+func (*spillStore) Destruct() error { return nil }
+
+// spillFile 在Redis不可用时把写入失败的日志追加到本地文件，恢复后再重新写入
+type spillFile struct {
+	*spillStore
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startSpill 打开落盘文件并启动后台重放协程，上次遗留的日志也会被重放
+func (rl *RedisLogger) startSpill() error {
+	if rl.SpillMaxBytes <= 0 {
+		rl.SpillMaxBytes = defaultSpillMaxBytes
+	}
+	if rl.SpillRetryInterval <= 0 {
+		rl.SpillRetryInterval = caddy.Duration(defaultSpillRetryInterval)
+	}
+	if err := os.MkdirAll(rl.SpillDir, 0o700); err != nil {
+		return fmt.Errorf("creating spill directory: %w", err)
+	}
+
+	path := rl.spillPath()
+	val, _, err := spillPool.LoadOrNew(path, func() (caddy.Destructor, error) {
+		store := &spillStore{path: path, max: rl.SpillMaxBytes}
+		if info, err := os.Stat(path); err == nil {
+			store.size = info.Size()
+		}
+		return store, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rl.spill = &spillFile{
+		spillStore: val.(*spillStore),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go rl.runSpillReplay()
+	return nil
+}
+
+// spillPath 返回落盘文件的路径。多个实例可以共用一个目录，按Redis地址、DB与key区分文件，
+// 写往不同Redis或不同DB的同名key不会混在一个文件里、重放到错误的地方。
+// 重放时按当前实例的配置写入，影响写入方式的选项（output_mode、use_script、transactional、
+// max_len、key_ttl、key_prefix）也计入文件名，共用文件的实例写入方式必然相同
+func (rl *RedisLogger) spillPath() string {
+	db := rl.db()
+	if rl.RedisURL != "" {
+		// redis_url 中的DB优先于 redis_db
+		if opts, err := redis.ParseURL(rl.RedisURL); err == nil {
+			db = opts.DB
+		}
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%s\x00%s\x00%t\x00%t\x00%d\x00%d",
+		rl.displayAddress(), db, rl.RedisKey, rl.KeyPrefix, rl.OutputMode, rl.UseScript, rl.Transactional, rl.MaxLen, rl.KeyTTL)
+	return filepath.Join(rl.SpillDir, fmt.Sprintf("redis_logger-%x.ndjson", h.Sum64()))
+}
+
+// write 把日志追加到落盘文件，超过 SpillMaxBytes 时返回错误
+func (st *spillStore) write(items []logItem) error {
+	buf, err := encodeSpilled(items)
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.size+int64(len(buf)) > st.max {
+		return fmt.Errorf("spill file is full (%d bytes)", st.max)
+	}
+	f, err := os.OpenFile(st.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	n, err := f.Write(buf)
+	st.size += int64(n)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// encodeSpilled 把日志编码为落盘文件中的行
+func encodeSpilled(items []logItem) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, item := range items {
+		line, err := json.Marshal(spilledItem{Key: item.key, Value: item.value, Hash: item.hash, Stream: item.stream, Zset: item.zset, Score: item.score, Base: item.base})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// runSpillReplay 定期把落盘的日志重新写入Redis
+func (rl *RedisLogger) runSpillReplay() {
+	defer close(rl.spill.done)
+
+	// 重放可能在等待限流，停止时通过 ctx 中断
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-rl.spill.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(time.Duration(rl.SpillRetryInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rl.spill.stop:
+			return
+		case <-ticker.C:
+			if err := rl.replaySpill(ctx); err != nil {
+				rl.logger.Warn("Spilled log entries not yet delivered", zap.Error(err))
+			}
+		}
+	}
+}
+
+// replayPath 是重放中的日志所在的文件
+func (st *spillStore) replayPath() string {
+	return st.path + ".replay"
+}
+
+// take 把落盘文件改名为重放文件并清空计数，之后写入的日志进入新的落盘文件。
+// 上次重放没有结束（如进程崩溃）时重放文件仍然存在，先重放它。
+func (st *spillStore) take() (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, err := os.Stat(st.replayPath()); err == nil {
+		return true, nil
+	}
+	if st.size == 0 {
+		return false, nil
+	}
+	if err := os.Rename(st.path, st.replayPath()); err != nil {
+		return false, err
+	}
+	st.size = 0
+	return true, nil
+}
+
+// putBack 把没有写入的日志放回落盘文件的开头，保持原来的顺序
+func (st *spillStore) putBack(items []logItem) error {
+	rest, err := encodeSpilled(items)
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	newer, err := os.ReadFile(st.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, append(rest, newer...), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, st.path); err != nil {
+		return err
+	}
+	st.size = int64(len(rest) + len(newer))
+	return os.Remove(st.replayPath())
+}
+
+// replaySpill 重放落盘文件，失败时把剩余的日志放回落盘文件等待下次重试。
+// 写入Redis时不持有 mu，请求路径上的落盘写入不会被较长的重放阻塞。
+// 开启 MaxPushesPerSecond 时重放与请求共用令牌桶，被限流而落盘的日志不会在重放时再形成突发。
+func (rl *RedisLogger) replaySpill(ctx context.Context) error {
+	st := rl.spill.spillStore
+	if !st.replayMu.TryLock() {
+		return nil
+	}
+	defer st.replayMu.Unlock()
+
+	if ok, err := st.take(); !ok || err != nil {
+		return err
+	}
+	data, err := os.ReadFile(st.replayPath())
+	if err != nil {
+		return err
+	}
+
+	var items []logItem
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), max(len(data), 64*1024))
+	for scanner.Scan() {
+		var spilled spilledItem
+		if err := json.Unmarshal(scanner.Bytes(), &spilled); err != nil {
+			rl.logger.Error("Skipping corrupt spilled log entry", zap.Error(err))
+			continue
+		}
+		items = append(items, logItem{key: spilled.Key, value: spilled.Value, hash: spilled.Hash, stream: spilled.Stream, zset: spilled.Zset, score: spilled.Score, base: spilled.Base})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	delivered := 0
+	for delivered < len(items) {
+		end := min(delivered+spillReplayBatchSize, len(items))
+		if err := rl.waitRateLimit(ctx, items[delivered:end]); err != nil {
+			break
+		}
+		if err := rl.pushBatch(ctx, items[delivered:end]); err != nil {
+			break
+		}
+		delivered = end
+	}
+	if delivered > 0 {
+		rl.logger.Info("Delivered spilled log entries", zap.Int("entries", delivered))
+	}
+	if delivered == len(items) {
+		return os.Remove(st.replayPath())
+	}
+	if err := st.putBack(items[delivered:]); err != nil {
+		return err
+	}
+	return fmt.Errorf("%d entries remaining", len(items)-delivered)
+}
+
+// close 停止重放协程并释放共享的落盘文件
+func (sf *spillFile) close() {
+	close(sf.stop)
+	<-sf.done
+	spillPool.Delete(sf.path)
+}
@@ -0,0 +1,127 @@
+package redislogger
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestSpillDeliveredAfterRecovery(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.SpillDir = t.TempDir()
+		rl.SpillRetryInterval = caddy.Duration(20 * time.Millisecond)
+		rl.WriteTimeout = 100 * time.Millisecond
+		rl.OnError = onErrorFail
+	})
+
+	mr.Close()
+	for _, path := range []string{"/a", "/b", "/c"} {
+		// 落盘成功时不算写入失败，请求不会因为 on_error fail 而报错
+		serve(t, rl, newTestRequest("GET", path, nil), respond(200, "", "ok"))
+	}
+	if info, err := os.Stat(rl.spill.path); err != nil || info.Size() == 0 {
+		t.Fatalf("entries were not spilled to %s: %v", rl.spill.path, err)
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "spilled entries to be replayed", func() bool { return listLen(mr, "access") == 3 })
+
+	// 重放按落盘顺序 LPUSH，最新的在列表头部
+	got := entries(t, mr, "access")
+	for i, want := range []string{"/c", "/b", "/a"} {
+		if uri := got[i]["request"].(map[string]any)["uri"]; uri != want {
+			t.Errorf("entry %d uri = %v, want %s", i, uri, want)
+		}
+	}
+	waitFor(t, "spill files to be removed", func() bool {
+		rl.spill.mu.Lock()
+		defer rl.spill.mu.Unlock()
+		_, err := os.Stat(rl.spill.replayPath())
+		return os.IsNotExist(err) && rl.spill.size == 0
+	})
+}
+
+func TestSpillMaxBytes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.SpillDir = t.TempDir()
+		rl.SpillMaxBytes = 1
+		rl.SpillRetryInterval = caddy.Duration(time.Hour)
+		rl.WriteTimeout = 100 * time.Millisecond
+		rl.OnError = onErrorFail
+	})
+	mr.Close()
+
+	// 落盘文件已满时回退到 on_error 策略
+	if err := rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/", nil), respond(200, "", "ok")); err == nil {
+		t.Error("expected on_error fail once the spill file is full")
+	}
+	if _, err := os.Stat(rl.spill.path); !os.IsNotExist(err) {
+		t.Errorf("nothing should be written past spill_max_bytes: %v", err)
+	}
+}
+
+func TestSpillSharedByKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	dir := t.TempDir()
+	configure := func(rl *RedisLogger) {
+		rl.SpillDir = dir
+		rl.SpillRetryInterval = caddy.Duration(time.Hour)
+	}
+	a := newTestLogger(t, mr, configure)
+	b := newTestLogger(t, mr, configure)
+
+	// 同一个key的实例共用一个 spillStore，文件与锁只有一份
+	if a.spill.spillStore != b.spill.spillStore {
+		t.Error("loggers with the same redis_key should share the spill store")
+	}
+}
+
+func TestSpillFilePerTarget(t *testing.T) {
+	mr := miniredis.RunT(t)
+	other := miniredis.RunT(t)
+	dir := t.TempDir()
+	spillTo := func(configure func(rl *RedisLogger)) *spillStore {
+		t.Helper()
+		return newTestLogger(t, mr, func(rl *RedisLogger) {
+			rl.SpillDir = dir
+			rl.SpillRetryInterval = caddy.Duration(time.Hour)
+			if configure != nil {
+				configure(rl)
+			}
+		}).spill.spillStore
+	}
+	db1 := 1
+
+	// 同名的key写往不同的Redis地址或DB时各自一个文件
+	stores := map[string]*spillStore{
+		"default":       spillTo(nil),
+		"other key":     spillTo(func(rl *RedisLogger) { rl.RedisKey = "errors" }),
+		"other address": spillTo(func(rl *RedisLogger) { rl.RedisAddress = other.Addr() }),
+		"other db":      spillTo(func(rl *RedisLogger) { rl.RedisDB = &db1 }),
+		// 重放按当前实例的配置写入，写入方式不同的实例不共用文件
+		"use_script": spillTo(func(rl *RedisLogger) { rl.UseScript = true }),
+		"max_len":    spillTo(func(rl *RedisLogger) { rl.MaxLen = 100 }),
+		"key_ttl":    spillTo(func(rl *RedisLogger) { rl.KeyTTL = caddy.Duration(time.Hour) }),
+		"key_prefix": spillTo(func(rl *RedisLogger) { rl.KeyPrefix = "prod:" }),
+	}
+	paths := make(map[string]string)
+	for name, store := range stores {
+		if prev, ok := paths[store.path]; ok {
+			t.Errorf("%s and %s share the spill file %s", name, prev, store.path)
+		}
+		paths[store.path] = name
+	}
+	// redis_url 中的DB与 redis_db 指向同一个目标
+	url := spillTo(func(rl *RedisLogger) { rl.RedisAddress, rl.RedisURL = "", "redis://"+mr.Addr()+"/1" })
+	if url != stores["other db"] {
+		t.Error("redis_url with DB 1 and redis_db 1 should share the spill file")
+	}
+}
@@ -0,0 +1,63 @@
+package redislogger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestUniqueIPKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.UniqueIPKey = "visitors"
+	})
+	rc := recordPipelines(rl)
+
+	for _, addr := range []string{"198.51.100.1:1000", "198.51.100.2:1000", "198.51.100.1:2000"} {
+		r := newTestRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		serve(t, rl, r, respond(200, "", "ok"))
+	}
+
+	if n, err := mr.PfCount("visitors"); err != nil || n != 2 {
+		t.Errorf("PFCOUNT visitors = %d, %v; want 2", n, err)
+	}
+	// PFADD 与日志在同一个pipeline中
+	for _, cmds := range rc.calls() {
+		if len(cmds) != 2 || cmds[0] != "lpush" || cmds[1] != "pfadd" {
+			t.Errorf("expected lpush and pfadd in one pipeline, got %v", cmds)
+		}
+	}
+}
+
+func TestStatsCounters(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.StatsKeyPrefix = "stats"
+		rl.StatsTTL = caddy.Duration(time.Hour)
+	})
+
+	for _, req := range []struct {
+		method string
+		status int
+	}{{"GET", 200}, {"GET", 200}, {"POST", 201}, {"GET", 404}} {
+		serve(t, rl, newTestRequest(req.method, "/", nil), respond(req.status, "", "ok"))
+	}
+
+	for key, want := range map[string]string{
+		"stats:status:200":  "2",
+		"stats:status:201":  "1",
+		"stats:status:404":  "1",
+		"stats:method:GET":  "3",
+		"stats:method:POST": "1",
+	} {
+		if got, err := mr.Get(key); err != nil || got != want {
+			t.Errorf("%s = %q, %v; want %s", key, got, err, want)
+		}
+		if ttl := mr.TTL(key); ttl != time.Hour {
+			t.Errorf("%s TTL = %v, want 1h", key, ttl)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package redislogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+const (
+	transformerNamespace = "http.handlers.redis_logger.transformers"
+	transformerKey       = "transformer" // 内联指定模块名的字段
+)
+
+func init() {
+	caddy.RegisterModule(LowercaseHeaders{})
+}
+
+// LogTransformer 在序列化之前修改每条日志，用于补充或删除字段。
+// 实现为 http.handlers.redis_logger.transformers 命名空间下的Caddy模块，
+// 通过 transformers 配置加载，按配置顺序依次调用。
+// entry 为原生结构（request、resp_headers 等），可以直接修改后返回，也可以返回新的map。
+type LogTransformer interface {
+	TransformEntry(entry map[string]interface{}) map[string]interface{}
+}
+
+// loadTransformers 按配置顺序加载 transformers。
+// 不用 ctx.LoadModule：Go 1.27 起 json.RawMessage 是 jsontext.Value 的别名，
+// Caddy 2.8 认不出 []json.RawMessage 字段，不报错也不加载任何模块
+func (rl *RedisLogger) loadTransformers(ctx caddy.Context) error {
+	for i, raw := range rl.TransformersRaw {
+		var cfg map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return fmt.Errorf("position %d: %v", i, err)
+		}
+		var name string
+		if err := json.Unmarshal(cfg[transformerKey], &name); err != nil || name == "" {
+			return fmt.Errorf("position %d: module name not specified with key '%s'", i, transformerKey)
+		}
+		delete(cfg, transformerKey)
+		rest, err := json.Marshal(cfg)
+		if err != nil {
+			return fmt.Errorf("position %d: %v", i, err)
+		}
+		mod, err := ctx.LoadModuleByID(transformerNamespace+"."+name, rest)
+		if err != nil {
+			return fmt.Errorf("position %d: loading module '%s': %v", i, name, err)
+		}
+		t, ok := mod.(LogTransformer)
+		if !ok {
+			return fmt.Errorf("position %d: module '%s' is not a LogTransformer", i, name)
+		}
+		rl.transformers = append(rl.transformers, t)
+	}
+	return nil
+}
+
+// entryMap 把日志转为map并依次调用 transformers
+func (rl *RedisLogger) entryMap(record *accessEntry) map[string]interface{} {
+	entry := record.toMap()
+	for _, t := range rl.transformers {
+		entry = t.TransformEntry(entry)
+	}
+	return entry
+}
+
+// LowercaseHeaders 把请求头与响应头的名称转为小写，同名的值合并，
+// 方便下游按固定的小写名称查询
+type LowercaseHeaders struct{}
+
+func (LowercaseHeaders) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.redis_logger.transformers.lowercase_headers",
+		New: func() caddy.Module { return new(LowercaseHeaders) },
+	}
+}
+
+// TransformEntry 实现了 LogTransformer
+func (LowercaseHeaders) TransformEntry(entry map[string]interface{}) map[string]interface{} {
+	if req, ok := entry["request"].(map[string]interface{}); ok {
+		if h, ok := req["headers"].(http.Header); ok {
+			req["headers"] = lowercaseHeader(h)
+		}
+	}
+	if h, ok := entry["resp_headers"].(http.Header); ok {
+		entry["resp_headers"] = lowercaseHeader(h)
+	}
+	return entry
+}
+
+// lowercaseHeader 返回名称转为小写的副本
+func lowercaseHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		out[lower] = append(out[lower], values...)
+	}
+	return out
+}
+
+// UnmarshalCaddyfile 实现了 caddyfile.Unmarshaler，没有参数：
+//
+//	transformer lowercase_headers
+func (*LowercaseHeaders) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // 模块名
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ LogTransformer        = (*LowercaseHeaders)(nil)
+	_ caddyfile.Unmarshaler = (*LowercaseHeaders)(nil)
+)
@@ -0,0 +1,86 @@
+package redislogger
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(tagTransformer{})
+}
+
+// tagTransformer 是测试用的转换模块，给日志加上 tag 字段并删除 size，
+// 同时记下此时请求头的名称，用来检查调用顺序
+type tagTransformer struct {
+	Tag string `json:"tag,omitempty"`
+
+	sawHeader string
+}
+
+func (tagTransformer) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.redis_logger.transformers.test_tag",
+		New: func() caddy.Module { return new(tagTransformer) },
+	}
+}
+
+func (tt *tagTransformer) TransformEntry(entry map[string]interface{}) map[string]interface{} {
+	for name := range entry["request"].(map[string]interface{})["headers"].(http.Header) {
+		tt.sawHeader = name
+	}
+	entry["tag"] = tt.Tag
+	delete(entry, "size")
+	return entry
+}
+
+func TestTransformers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.TransformersRaw = []json.RawMessage{
+			json.RawMessage(`{"transformer":"lowercase_headers"}`),
+			json.RawMessage(`{"transformer":"test_tag","tag":"edge-1"}`),
+		}
+	})
+	if len(rl.transformers) != 2 {
+		t.Fatalf("loaded %d transformers, want 2", len(rl.transformers))
+	}
+	tagger := rl.transformers[1].(*tagTransformer)
+
+	r := newTestRequest("GET", "/", nil)
+	r.Header = http.Header{"X-Trace": {"abc"}}
+	serve(t, rl, r, respond(200, "", "ok"))
+
+	entry := lastEntry(t, mr, "access")
+	if entry["tag"] != "edge-1" {
+		t.Errorf("tag = %v, want the configured edge-1", entry["tag"])
+	}
+	if _, ok := entry["size"]; ok {
+		t.Error("size was not removed by the transformer")
+	}
+	// 按配置顺序调用，后面的模块拿到的是前面转换过的结果
+	if tagger.sawHeader != "x-trace" {
+		t.Errorf("test_tag saw header %q, want the lowercased x-trace", tagger.sawHeader)
+	}
+	headers := entry["request"].(map[string]any)["headers"].(map[string]any)
+	if _, ok := headers["x-trace"]; !ok {
+		t.Errorf("headers not lowercased: %v", headers)
+	}
+}
+
+func TestTransformersRejected(t *testing.T) {
+	mr := miniredis.RunT(t)
+	for _, raw := range []string{
+		`{"transformer":"missing"}`,
+		`{"tag":"edge-1"}`,
+		`{"transformer":"test_tag","unknown":1}`,
+	} {
+		rl := &RedisLogger{RedisKey: "access", RedisAddress: mr.Addr(), TransformersRaw: []json.RawMessage{json.RawMessage(raw)}}
+		if err := provision(t, rl); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package redislogger
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// trimmer 记录上次裁剪之后写入过的列表key，由后台协程每隔 TrimInterval 统一 LTRIM
+type trimmer struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// realTimer 是 RedisLogger.newTimer 的默认实现
+func realTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// trimWait 返回下一次裁剪前的等待时间，在 [interval/2, interval*3/2) 中随机选取，
+// 平均仍为 interval。多个实例、重载前后的配置不会在同一时刻一起裁剪。
+func trimWait(interval time.Duration) time.Duration {
+	return interval/2 + time.Duration(rand.Int63n(int64(interval)))
+}
+
+// startTrimmer 在配置了 TrimInterval 与 MaxLen 时启动后台裁剪协程
+func (rl *RedisLogger) startTrimmer() {
+	if rl.TrimInterval <= 0 || rl.MaxLen <= 0 {
+		return
+	}
+	rl.trimmer = &trimmer{
+		keys: make(map[string]struct{}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go rl.runTrimmer()
+}
+
+// mark 记录需要裁剪的key
+func (t *trimmer) mark(keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		t.keys[key] = struct{}{}
+	}
+}
+
+// take 取出并清空待裁剪的key
+func (t *trimmer) take() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	keys := make([]string, 0, len(t.keys))
+	for key := range t.keys {
+		keys = append(keys, key)
+	}
+	clear(t.keys)
+	return keys
+}
+
+// runTrimmer 平均每隔 TrimInterval 裁剪一次（带随机抖动，见 trimWait），停止前再裁剪一次
+func (rl *RedisLogger) runTrimmer() {
+	defer close(rl.trimmer.done)
+
+	for {
+		fired, stop := rl.newTimer(trimWait(time.Duration(rl.TrimInterval)))
+		select {
+		case <-rl.trimmer.stop:
+			stop()
+			rl.trim()
+			return
+		case <-fired:
+			rl.trim()
+		}
+	}
+}
+
+// trim 在一个pipeline中把待裁剪的列表裁到 MaxLen
+func (rl *RedisLogger) trim() {
+	keys := rl.trimmer.take()
+	if len(keys) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rl.WriteTimeout)
+	defer cancel()
+	_, err := rl.client.get().Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			rl.trimKey(ctx, pipe, key)
+		}
+		return nil
+	})
+	if err != nil {
+		// 下次写入时会重新标记，这里不重试
+		rl.logger.Error("Error trimming log lists", zap.Error(err))
+	}
+}
+
+// stopTrimmer 停止后台裁剪协程
+func (t *trimmer) stopTrimmer() {
+	close(t.stop)
+	<-t.done
+}
@@ -0,0 +1,50 @@
+package redislogger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestTrimInterval(t *testing.T) {
+	mr := miniredis.RunT(t)
+	fired := make(chan time.Time)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.MaxLen = 2
+		rl.TrimInterval = caddy.Duration(time.Hour)
+		rl.newTimer = func(time.Duration) (<-chan time.Time, func() bool) {
+			return fired, func() bool { return true }
+		}
+	})
+	rc := recordPipelines(rl)
+
+	for i := 0; i < 5; i++ {
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}
+	// 写入时不再 LTRIM，列表在下一次定时裁剪前可以超过 max_len
+	for _, cmds := range rc.calls() {
+		if len(cmds) != 1 || cmds[0] != "lpush" {
+			t.Errorf("expected only lpush when pushing, got %v", cmds)
+		}
+	}
+	if n := listLen(mr, "access"); n != 5 {
+		t.Fatalf("list length before the trim = %d, want 5", n)
+	}
+
+	fired <- time.Now()
+	waitFor(t, "the list to be trimmed", func() bool { return listLen(mr, "access") == 2 })
+	calls := rc.calls()
+	if last := calls[len(calls)-1]; len(last) != 1 || last[0] != "ltrim" {
+		t.Errorf("expected the trimmer to send a single ltrim, got %v", last)
+	}
+}
+
+func TestTrimWait(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if wait := trimWait(time.Second); wait < 500*time.Millisecond || wait >= 1500*time.Millisecond {
+			t.Fatalf("trimWait(1s) = %v, want [500ms, 1.5s)", wait)
+		}
+	}
+}
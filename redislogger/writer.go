@@ -0,0 +1,296 @@
+package redislogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// logItem 是一条待写入Redis的日志
+type logItem struct {
+	key    string
+	value  []byte
+	hash   map[string]string // hash 模式下写入的字段，此时不使用 value
+	stream bool              // 用 XADD 写入stream，hash 不为nil时写入展开后的字段
+	zset   bool              // 用 ZADD 写入有序集合
+	score  float64           // zset 模式下的 score，即日志时间的Unix微秒数
+	stats  *requestStats     // 同一条日志写入多个key时只有第一个item带上，避免重复统计
+	base   string            // 展开后的 RedisKey，hash 模式下 key 带有请求ID，限流按它计算；为空时与 key 相同
+}
+
+// limitKey 返回限流使用的key：每个展开后的 RedisKey 一个令牌桶，而不是每个写入的key
+func (item logItem) limitKey() string {
+	if item.base != "" {
+		return item.base
+	}
+	return item.key
+}
+
+// stderrLine 返回打印到标准错误的内容：hash 与 stream_fields 模式下日志在 hash 中，
+// value 为空，把展开后的字段序列化为JSON
+func (item logItem) stderrLine() []byte {
+	if item.hash == nil {
+		return item.value
+	}
+	line, err := json.Marshal(item.hash)
+	if err != nil {
+		return nil
+	}
+	return line
+}
+
+// requestStats 是随日志一起写入的统计数据
+type requestStats struct {
+	clientIP string
+	status   int
+	method   string
+	requests int // 去重合并的请求数，0表示1
+}
+
+// 写入失败时的处理策略
+const (
+	onErrorIgnore = "ignore" // 只记录错误日志
+	onErrorStderr = "stderr" // 把日志打印到标准错误，与 RedisWriter 的行为一致
+	onErrorFail   = "fail"   // ServeHTTP 返回错误
+)
+
+// validateOnError 检查 OnError 配置是否合法
+func validateOnError(policy string) error {
+	switch policy {
+	case "", onErrorIgnore, onErrorStderr, onErrorFail:
+		return nil
+	default:
+		return fmt.Errorf("unsupported on_error policy '%s', expected ignore, stderr or fail", policy)
+	}
+}
+
+// send 把同一条日志写入各个key：先按 MaxPushesPerSecond 限流，再交给缓冲队列，
+// 未开启缓冲或队列已满时在一个pipeline中直接写入Redis。只有直接写入失败且策略为 fail 时才返回错误。
+func (rl *RedisLogger) send(items []logItem) error {
+	if items = rl.rateLimit(items); len(items) == 0 {
+		return nil
+	}
+	if rl.buffer != nil {
+		pending := items[:0]
+		for _, item := range items {
+			if rl.buffer.enqueue(item) {
+				continue
+			}
+			if rl.DropOnFull {
+				rl.metrics.drop(dropReasonBufferFull)
+				dropped := rl.buffer.dropped.Add(1)
+				rl.logger.Debug("Log buffer full, dropping entry",
+					zap.String("key", item.key),
+					zap.Uint64("dropped", dropped),
+				)
+				continue
+			}
+			pending = append(pending, item)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		items = pending
+	}
+
+	release, ok := rl.acquireInFlight(items)
+	if !ok {
+		return nil
+	}
+	defer release()
+
+	ctx := context.Background()
+	if err := rl.pushWithRetry(ctx, items); err != nil {
+		rl.logger.Error("Error pushing log entry to Redis", zap.Error(err))
+		return rl.handlePushError(items, err)
+	}
+	if ce := rl.logger.Check(zap.DebugLevel, "Pushed log entry to Redis"); ce != nil {
+		ce.Write(zap.Strings("keys", distinctKeys(items, false)))
+	}
+	return nil
+}
+
+// 写入失败后重试的默认等待时间
+const defaultPushRetryBackoff = 100 * time.Millisecond
+
+// pushWithRetry 写入失败后最多重试 PushRetries 次，等待时间从 PushRetryBackoff 开始翻倍。
+// 这是命令级别的重试，MaxRetries 只覆盖go-redis的网络错误；
+// pipeline 部分成功时重试可能写入重复的日志，开启 Transactional 可以避免。
+func (rl *RedisLogger) pushWithRetry(ctx context.Context, items []logItem) error {
+	wait := time.Duration(rl.PushRetryBackoff)
+	if wait <= 0 {
+		wait = defaultPushRetryBackoff
+	}
+
+	err := rl.pushBatch(ctx, items)
+	for attempt := 1; err != nil && attempt <= rl.PushRetries; attempt++ {
+		rl.logger.Warn("Error pushing log entry to Redis, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("wait", wait),
+			zap.Error(err),
+		)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+		err = rl.pushBatch(ctx, items)
+	}
+	return err
+}
+
+// handlePushError 处理写入失败的日志：开启落盘时先写入本地文件，否则按 OnError 策略处理
+func (rl *RedisLogger) handlePushError(items []logItem, err error) error {
+	if rl.spill != nil {
+		spillErr := rl.spill.write(items)
+		if spillErr == nil {
+			return nil
+		}
+		rl.logger.Error("Error spilling log entries to disk", zap.Error(spillErr))
+		for range items {
+			rl.metrics.drop(dropReasonSpillFull)
+		}
+	}
+
+	switch rl.OnError {
+	case onErrorStderr:
+		for _, item := range items {
+			os.Stderr.Write(append(item.stderrLine(), '\n'))
+		}
+	case onErrorFail:
+		return err
+	}
+	return nil
+}
+
+// validateTransactional 检查 Transactional 与集群模式的组合。
+// 集群客户端的 TxPipelined 按哈希槽拆成多个 MULTI/EXEC，不同槽的key之间并不原子，
+// 所以集群模式下只允许所有命令都落在同一个固定key上的配置。
+func (rl *RedisLogger) validateTransactional() error {
+	if !rl.Transactional || len(rl.ClusterAddrs) == 0 {
+		return nil
+	}
+	switch {
+	case rl.keyHasPlaceholders || rl.timeKeys != nil || len(rl.RedisKeys) > 0 || rl.ShardByMethod:
+		return fmt.Errorf("transactional with cluster_addrs requires a single redis_key without placeholders")
+	case rl.OutputMode == outputHash:
+		return fmt.Errorf("transactional with cluster_addrs cannot be used with output_mode hash, each entry has its own key")
+	case rl.UniqueIPKey != "" || rl.StatsKeyPrefix != "":
+		return fmt.Errorf("transactional with cluster_addrs cannot be used with unique_ip_key or stats_key_prefix")
+	}
+	return nil
+}
+
+// pipelinePush 通过pipeline一次写入多条日志，LPUSH、LTRIM 与 EXPIRE 在同一次往返中发送。
+// 开启 Transactional 时用 MULTI/EXEC 包裹，这些命令要么全部生效要么都不生效；
+// 开启 UseScript 时每条日志由一次 EVALSHA 在Redis端完成这三个命令。
+func (rl *RedisLogger) pipelinePush(ctx context.Context, client redisClient, items []logItem) error {
+	pipelined := client.Pipelined
+	if rl.Transactional {
+		pipelined = client.TxPipelined
+	}
+
+	start := time.Now()
+	cmds, err := pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			switch {
+			case item.stream:
+				rl.streamAdd(ctx, pipe, item)
+			case item.hash != nil:
+				pipe.HSet(ctx, item.key, hashArgs(item.hash)...)
+				pipe.Expire(ctx, item.key, rl.hashTTL())
+			case item.zset:
+				pipe.ZAdd(ctx, item.key, &redis.Z{Score: item.score, Member: item.value})
+			case rl.UseScript:
+				rl.scriptPush(ctx, pipe, item)
+			case rl.ReliableQueue:
+				pipe.RPush(ctx, item.key, item.value)
+			default:
+				pipe.LPush(ctx, item.key, item.value)
+			}
+			if item.stats != nil {
+				rl.pushStats(ctx, pipe, item.stats)
+			}
+		}
+		if rl.UseScript {
+			return nil
+		}
+		listKeys := distinctKeys(items, true)
+		if rl.trimmer != nil {
+			rl.trimmer.mark(listKeys)
+		}
+		for _, key := range listKeys {
+			if rl.MaxLen > 0 && rl.trimmer == nil {
+				rl.trimKey(ctx, pipe, key)
+			}
+			if rl.KeyTTL > 0 {
+				pipe.Expire(ctx, key, time.Duration(rl.KeyTTL))
+			}
+		}
+		return nil
+	})
+	if rl.UseScript && err != nil {
+		err = rl.retryNoScript(ctx, client, cmds, err)
+	}
+	rl.metrics.writeDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		rl.metrics.pushErrors.Inc()
+		rl.metrics.pushErrorsTotal.Add(1)
+		// Pipelined 只返回第一个错误，这里把每条失败的命令都记录下来
+		for _, cmd := range cmds {
+			if cmdErr := cmd.Err(); cmdErr != nil {
+				rl.logger.Error("Redis pipeline command failed",
+					zap.String("command", cmd.Name()),
+					zap.Any("key", cmd.Args()[1]),
+					zap.Error(cmdErr),
+				)
+			}
+		}
+		return err
+	}
+	rl.metrics.pushed.Add(float64(len(items)))
+	rl.metrics.pushedTotal.Add(uint64(len(items)))
+	return nil
+}
+
+// pushStats 在写日志的pipeline中附带更新统计数据
+func (rl *RedisLogger) pushStats(ctx context.Context, pipe redis.Pipeliner, stats *requestStats) {
+	if rl.UniqueIPKey != "" && stats.clientIP != "" {
+		pipe.PFAdd(ctx, rl.KeyPrefix+rl.UniqueIPKey, stats.clientIP)
+	}
+	if rl.StatsKeyPrefix != "" {
+		for _, key := range []string{
+			rl.KeyPrefix + rl.StatsKeyPrefix + ":status:" + strconv.Itoa(stats.status),
+			rl.KeyPrefix + rl.StatsKeyPrefix + ":method:" + stats.method,
+		} {
+			pipe.IncrBy(ctx, key, int64(max(1, stats.requests)))
+			if rl.StatsTTL > 0 {
+				pipe.Expire(ctx, key, time.Duration(rl.StatsTTL))
+			}
+		}
+	}
+}
+
+// distinctKeys 按首次出现的顺序返回批次中涉及的key，listsOnly 时跳过 hash 与 stream 的key
+func distinctKeys(items []logItem, listsOnly bool) []string {
+	keys := make([]string, 0, 1)
+	seen := make(map[string]struct{}, 1)
+	for _, item := range items {
+		if listsOnly && (item.hash != nil || item.stream) {
+			continue
+		}
+		if _, ok := seen[item.key]; ok {
+			continue
+		}
+		seen[item.key] = struct{}{}
+		keys = append(keys, item.key)
+	}
+	return keys
+}
@@ -0,0 +1,342 @@
+package redislogger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// recordingClient 包装真实的客户端，记录每次pipeline中发送的命令
+type recordingClient struct {
+	redisClient
+
+	mu        sync.Mutex
+	pipelines [][]string
+	tx        []bool
+}
+
+// recordPipelines 把 rl 当前的客户端替换为 recordingClient
+func recordPipelines(rl *RedisLogger) *recordingClient {
+	rc := &recordingClient{redisClient: rl.client.get()}
+	rl.client.mu.Lock()
+	rl.client.client = rc
+	rl.client.mu.Unlock()
+	return rc
+}
+
+func (rc *recordingClient) record(tx bool, cmds []redis.Cmder) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.pipelines = append(rc.pipelines, names)
+	rc.tx = append(rc.tx, tx)
+}
+
+func (rc *recordingClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	cmds, err := rc.redisClient.Pipelined(ctx, fn)
+	rc.record(false, cmds)
+	return cmds, err
+}
+
+func (rc *recordingClient) TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	cmds, err := rc.redisClient.TxPipelined(ctx, fn)
+	rc.record(true, cmds)
+	return cmds, err
+}
+
+// calls 返回记录的pipeline
+func (rc *recordingClient) calls() [][]string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([][]string(nil), rc.pipelines...)
+}
+
+func TestPushAndTrimInOnePipeline(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.MaxLen = 2
+	})
+	rc := recordPipelines(rl)
+
+	for i := 0; i < 3; i++ {
+		serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	}
+	if n := listLen(mr, "access"); n != 2 {
+		t.Fatalf("expected the list to be trimmed to 2, got %d", n)
+	}
+
+	calls := rc.calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected one pipeline per request, got %d", len(calls))
+	}
+	for _, cmds := range calls {
+		if len(cmds) != 2 || cmds[0] != "lpush" || cmds[1] != "ltrim" {
+			t.Errorf("expected lpush and ltrim in one pipeline, got %v", cmds)
+		}
+	}
+}
+
+func TestKeyTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.KeyTTL = caddy.Duration(time.Hour)
+	})
+	rc := recordPipelines(rl)
+
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if ttl := mr.TTL("access"); ttl != time.Hour {
+		t.Fatalf("expected a 1h TTL, got %v", ttl)
+	}
+	if calls := rc.calls(); len(calls) != 1 || len(calls[0]) != 2 || calls[0][1] != "expire" {
+		t.Errorf("expected lpush and expire in one pipeline, got %v", calls)
+	}
+
+	// 每次写入都刷新过期时间
+	mr.FastForward(30 * time.Minute)
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	if ttl := mr.TTL("access"); ttl != time.Hour {
+		t.Fatalf("expected the TTL to be refreshed, got %v", ttl)
+	}
+}
+
+// captureStderr 执行 fn 并返回期间写到标准错误的内容
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = orig }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestOnErrorPolicies(t *testing.T) {
+	for _, policy := range []string{onErrorIgnore, onErrorStderr, onErrorFail} {
+		t.Run(policy, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.OnError = policy
+				rl.WriteTimeout = 100 * time.Millisecond
+			})
+			mr.Close()
+
+			var err error
+			stderr := captureStderr(t, func() {
+				err = rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/down", nil), respond(200, "", "ok"))
+			})
+			if (err != nil) != (policy == onErrorFail) {
+				t.Errorf("ServeHTTP error = %v", err)
+			}
+			if logged := strings.Contains(stderr, `"uri":"/down"`); logged != (policy == onErrorStderr) {
+				t.Errorf("stderr = %q", stderr)
+			}
+		})
+	}
+}
+
+// flakyClient 的前 failures 次写入直接失败，之后交给真实的客户端，并记录每次写入的时间
+type flakyClient struct {
+	redisClient
+
+	mu       sync.Mutex
+	failures int
+	attempts []time.Time
+}
+
+func (fc *flakyClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	fc.mu.Lock()
+	fc.attempts = append(fc.attempts, time.Now())
+	fail := len(fc.attempts) <= fc.failures
+	fc.mu.Unlock()
+	if fail {
+		return nil, errors.New("connection reset by peer")
+	}
+	return fc.redisClient.Pipelined(ctx, fn)
+}
+
+func TestPushRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		retries   int
+		delivered bool
+	}{
+		{"third attempt succeeds", 3, true},
+		{"retries exhausted", 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+				rl.PushRetries = tc.retries
+				rl.PushRetryBackoff = caddy.Duration(10 * time.Millisecond)
+				rl.OnError = onErrorFail
+			})
+			fc := &flakyClient{redisClient: rl.client.get(), failures: 2}
+			rl.client.mu.Lock()
+			rl.client.client = fc
+			rl.client.mu.Unlock()
+
+			err := rl.ServeHTTP(httptest.NewRecorder(), newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+			if (err == nil) != tc.delivered {
+				t.Errorf("ServeHTTP error = %v", err)
+			}
+			want := 0
+			if tc.delivered {
+				want = 1
+			}
+			if n := listLen(mr, "access"); n != want {
+				t.Errorf("got %d entries, want %d", n, want)
+			}
+
+			// 第一次写入加上 PushRetries 次重试，成功后不再重试
+			fc.mu.Lock()
+			defer fc.mu.Unlock()
+			if n := len(fc.attempts); n != min(tc.retries+1, 3) {
+				t.Fatalf("made %d attempts", n)
+			}
+			// 等待时间从 push_retry_backoff 开始翻倍
+			for i := 1; i < len(fc.attempts); i++ {
+				backoff := 10 * time.Millisecond << (i - 1)
+				if gap := fc.attempts[i].Sub(fc.attempts[i-1]); gap < backoff {
+					t.Errorf("retry %d after %v, want at least %v", i, gap, backoff)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionalPush(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.Transactional = true
+		rl.MaxLen = 10
+	})
+
+	// 在服务端记录收到的命令，确认写入被 MULTI/EXEC 包裹
+	var mu sync.Mutex
+	var received []string
+	mr.Server().SetPreHook(func(_ *server.Peer, cmd string, _ ...string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, strings.ToLower(cmd))
+		return false
+	})
+	serve(t, rl, newTestRequest("GET", "/", nil), respond(200, "", "ok"))
+	lastEntry(t, mr, "access")
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"multi", "lpush", "ltrim", "exec"}
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("server received %v, want %v", received, want)
+	}
+}
+
+func TestScriptPush(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl := newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.UseScript = true
+		rl.MaxLen = 2
+		rl.KeyTTL = caddy.Duration(time.Hour)
+	})
+
+	// 只记录客户端发来的脚本命令，脚本内部的 LPUSH 等也会经过钩子
+	var mu sync.Mutex
+	var received []string
+	mr.Server().SetPreHook(func(_ *server.Peer, cmd string, _ ...string) bool {
+		if cmd = strings.ToLower(cmd); strings.HasPrefix(cmd, "eval") {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, cmd)
+		}
+		return false
+	})
+	commands := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		out := received
+		received = nil
+		return out
+	}
+
+	// 脚本还没缓存时 EVALSHA 返回 NOSCRIPT，改用 EVAL 执行并缓存脚本
+	serve(t, rl, newTestRequest("GET", "/1", nil), respond(200, "", "ok"))
+	if got, want := commands(), []string{"evalsha", "eval"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first push sent %v, want %v", got, want)
+	}
+	// 之后 EVALSHA 直接命中
+	serve(t, rl, newTestRequest("GET", "/2", nil), respond(200, "", "ok"))
+	serve(t, rl, newTestRequest("GET", "/3", nil), respond(200, "", "ok"))
+	if got, want := commands(), []string{"evalsha", "evalsha"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cached pushes sent %v, want %v", got, want)
+	}
+
+	// 脚本在Redis端完成裁剪与过期
+	if n := listLen(mr, "access"); n != 2 {
+		t.Errorf("list has %d entries, want max_len 2", n)
+	}
+	if ttl := mr.TTL("access"); ttl != time.Hour {
+		t.Errorf("TTL = %v, want 1h", ttl)
+	}
+
+	// SCRIPT FLUSH 之后再次回退到 EVAL，日志不丢
+	if err := rl.client.get().ScriptFlush(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	commands()
+	serve(t, rl, newTestRequest("GET", "/4", nil), respond(200, "", "ok"))
+	if got, want := commands(), []string{"evalsha", "eval"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("push after SCRIPT FLUSH sent %v, want %v", got, want)
+	}
+	if uri := entries(t, mr, "access")[0]["request"].(map[string]any)["uri"]; uri != "/4" {
+		t.Errorf("newest entry is %v, want /4", uri)
+	}
+}
+
+func TestTransactionalClusterValidation(t *testing.T) {
+	for name, configure := range map[string]func(*RedisLogger){
+		"placeholder key": func(rl *RedisLogger) { rl.RedisKey = "logs:{http.request.host}" },
+		"time key":        func(rl *RedisLogger) { rl.RedisKey = "logs:%Y-%m-%d" },
+		"several keys":    func(rl *RedisLogger) { rl.RedisKeys = []string{"archive"} },
+		"hash output":     func(rl *RedisLogger) { rl.OutputMode = outputHash },
+		"unique ip key":   func(rl *RedisLogger) { rl.UniqueIPKey = "visitors" },
+	} {
+		rl := &RedisLogger{RedisKey: "access", ClusterAddrs: []string{"127.0.0.1:1"}, Transactional: true}
+		configure(rl)
+		if err := provision(t, rl); err == nil || !strings.Contains(err.Error(), "transactional") {
+			t.Errorf("%s: expected transactional with cluster_addrs to be rejected, got %v", name, err)
+		}
+	}
+
+	// 单个固定key的所有命令落在同一个槽，可以使用事务
+	mr := miniredis.RunT(t)
+	newTestLogger(t, mr, func(rl *RedisLogger) {
+		rl.RedisAddress = ""
+		rl.ClusterAddrs = []string{mr.Addr()}
+		rl.Transactional = true
+	})
+}
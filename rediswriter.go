@@ -1,31 +1,53 @@
 package logging
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"net"
+	"math/rand/v2"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/go-redis/redis/v8"
 )
 
 func init() {
 	caddy.RegisterModule(RedisWriter{})
 }
 
-// NetWriter implements a log writer that outputs to a network socket. If
-// the socket goes down, it will dump logs to stderr while it attempts to
-// reconnect.
+// RedisWriter implements a log writer that pushes each log line onto a
+// Redis list. If Redis goes down, it will dump logs to stderr while it
+// attempts to reconnect.
 type RedisWriter struct {
-	// The address of the network socket to which to connect.
+	// The address of the Redis server to which to connect.
 	Address string `json:"address,omitempty"`
 
+	// The Redis list that log lines are pushed onto.
+	RedisKey string `json:"redis_key,omitempty"`
+
+	// The ACL username used to authenticate with Redis 6+.
+	RedisUsername string `json:"redis_username,omitempty"`
+
+	// The password used to authenticate with Redis.
+	RedisPassword string `json:"redis_password,omitempty"`
+
+	// The Redis database to select.
+	RedisDB int `json:"redis_db,omitempty"`
+
 	// The timeout to wait while connecting to the socket.
 	DialTimeout caddy.Duration `json:"dial_timeout,omitempty"`
 
+	// The minimum and maximum time to wait between attempts to
+	// reconnect after a push fails. The wait doubles after every
+	// failed attempt, and random jitter is applied. Default: 1s and 30s.
+	ReconnectMinInterval caddy.Duration `json:"reconnect_min_interval,omitempty"`
+	ReconnectMaxInterval caddy.Duration `json:"reconnect_max_interval,omitempty"`
+
 	// If enabled, allow connections errors when first opening the
 	// writer. The error and subsequent log entries will be reported
 	// to stderr instead until a connection can be re-established.
@@ -63,23 +85,43 @@ func (nw *RedisWriter) Provision(ctx caddy.Context) error {
 		return fmt.Errorf("timeout cannot be less than 0")
 	}
 
+	if nw.ReconnectMinInterval == 0 {
+		nw.ReconnectMinInterval = caddy.Duration(time.Second)
+	}
+	if nw.ReconnectMaxInterval == 0 {
+		nw.ReconnectMaxInterval = caddy.Duration(30 * time.Second)
+	}
+	if nw.ReconnectMinInterval < 0 || nw.ReconnectMaxInterval < nw.ReconnectMinInterval {
+		return fmt.Errorf("invalid reconnect intervals: min %s, max %s",
+			time.Duration(nw.ReconnectMinInterval), time.Duration(nw.ReconnectMaxInterval))
+	}
+
+	if nw.RedisKey == "" {
+		return fmt.Errorf("redis_key is required")
+	}
+
+	if nw.RedisDB < 0 {
+		return fmt.Errorf("redis_db cannot be less than 0")
+	}
+
 	return nil
 }
 
 func (nw RedisWriter) String() string {
-	return nw.addr.String()
+	return "redis://" + nw.addr.String() + "/" + strconv.Itoa(nw.RedisDB) + "/" + nw.RedisKey
 }
 
 // WriterKey returns a unique key representing this nw.
 func (nw RedisWriter) WriterKey() string {
-	return nw.addr.String()
+	return nw.String()
 }
 
-// OpenWriter opens a new network connection.
+// OpenWriter opens a new Redis connection.
 func (nw RedisWriter) OpenWriter() (io.WriteCloser, error) {
 	reconn := &RedisConn{
 		nw:      nw,
 		timeout: time.Duration(nw.DialTimeout),
+		now:     time.Now,
 	}
 	conn, err := reconn.dial()
 	if err != nil {
@@ -88,18 +130,24 @@ func (nw RedisWriter) OpenWriter() (io.WriteCloser, error) {
 		}
 		// don't block config load if remote is down or some other external problem;
 		// we can dump logs to stderr for now (see issue #5520)
-		fmt.Fprintf(os.Stderr, "[ERROR] net log writer failed to connect: %v (will retry connection and print errors here in the meantime)\n", err)
+		fmt.Fprintf(os.Stderr, "[ERROR] redis log writer failed to connect: %v (will retry connection and print errors here in the meantime)\n", err)
 	}
 	reconn.connMu.Lock()
-	reconn.Conn = conn
+	reconn.client = conn
 	reconn.connMu.Unlock()
 	return reconn, nil
 }
 
 // UnmarshalCaddyfile sets up the handler from Caddyfile tokens. Syntax:
 //
-//	net <address> {
+//	redislogger <address> {
+//	    redis_key <key>
+//	    redis_username <username>
+//	    redis_password <password>
+//	    redis_db <db>
 //	    dial_timeout <duration>
+//	    reconnect_min_interval <duration>
+//	    reconnect_max_interval <duration>
 //	    soft_start
 //	}
 func (nw *RedisWriter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
@@ -126,35 +174,87 @@ func (nw *RedisWriter) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 			}
 			nw.DialTimeout = caddy.Duration(timeout)
 
+		case "reconnect_min_interval", "reconnect_max_interval":
+			name := d.Val()
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			interval, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return d.Errf("invalid duration: %s", d.Val())
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			if name == "reconnect_min_interval" {
+				nw.ReconnectMinInterval = caddy.Duration(interval)
+			} else {
+				nw.ReconnectMaxInterval = caddy.Duration(interval)
+			}
+
 		case "soft_start":
 			if d.NextArg() {
 				return d.ArgErr()
 			}
 			nw.SoftStart = true
+
+		case "redis_key":
+			if !d.AllArgs(&nw.RedisKey) {
+				return d.ArgErr()
+			}
+
+		case "redis_username":
+			if !d.AllArgs(&nw.RedisUsername) {
+				return d.ArgErr()
+			}
+
+		case "redis_password":
+			if !d.AllArgs(&nw.RedisPassword) {
+				return d.ArgErr()
+			}
+
+		case "redis_db":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			db, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("invalid redis_db: %s", d.Val())
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			nw.RedisDB = db
 		}
 	}
 	return nil
 }
 
-// redialerConn wraps an underlying Conn so that if any
-// writes fail, the connection is redialed and the write
-// is retried.
+// RedisConn wraps a Redis client so that each write pushes
+// one log line onto the list. If a push fails, the client is
+// recreated and the push is retried.
 type RedisConn struct {
-	net.Conn
-	connMu     sync.RWMutex
-	nw         RedisWriter
-	timeout    time.Duration
-	lastRedial time.Time
+	client      *redis.Client
+	connMu      sync.RWMutex
+	nw          RedisWriter
+	timeout     time.Duration
+	lastRedial  time.Time
+	backoffBase time.Duration
+	redialDelay time.Duration
+
+	// now returns the current time; tests replace it
+	// to step through the backoff schedule.
+	now func() time.Time
 }
 
-// Write wraps the underlying Conn.Write method, but if that fails,
-// it will re-dial the connection anew and try writing again.
+// Write pushes b onto the Redis list, but if that fails,
+// it will re-dial the connection anew and try pushing again.
 func (reconn *RedisConn) Write(b []byte) (n int, err error) {
 	reconn.connMu.RLock()
-	conn := reconn.Conn
+	conn := reconn.client
 	reconn.connMu.RUnlock()
 	if conn != nil {
-		if n, err = conn.Write(b); err == nil {
+		if n, err = reconn.push(conn, b); err == nil {
 			return
 		}
 	}
@@ -165,8 +265,8 @@ func (reconn *RedisConn) Write(b []byte) (n int, err error) {
 
 	// if multiple concurrent writes failed on the same broken conn, then
 	// one of them might have already re-dialed by now; try writing again
-	if reconn.Conn != nil {
-		if n, err = reconn.Conn.Write(b); err == nil {
+	if reconn.client != nil {
+		if n, err = reconn.push(reconn.client, b); err == nil {
 			return
 		}
 	}
@@ -175,19 +275,26 @@ func (reconn *RedisConn) Write(b []byte) (n int, err error) {
 	// if some time has passed in which the issue could have potentially
 	// been resolved - we don't want to block at every single log
 	// emission (!) - see discussion in #4111
-	if time.Since(reconn.lastRedial) > 10*time.Second {
-		reconn.lastRedial = time.Now()
+	if now := reconn.now(); now.Sub(reconn.lastRedial) > reconn.redialDelay {
+		reconn.lastRedial = now
 		conn2, err2 := reconn.dial()
 		if err2 != nil {
 			// logger socket still offline; instead of discarding the log, dump it to stderr
+			reconn.backoff()
 			os.Stderr.Write(b)
 			return
 		}
-		if n, err = conn2.Write(b); err == nil {
-			if reconn.Conn != nil {
-				reconn.Conn.Close()
+		if n, err = reconn.push(conn2, b); err == nil {
+			if reconn.client != nil {
+				reconn.client.Close()
 			}
-			reconn.Conn = conn2
+			reconn.client = conn2
+			reconn.backoffBase = 0
+			reconn.redialDelay = 0
+		} else {
+			conn2.Close()
+			reconn.backoff()
+			os.Stderr.Write(b)
 		}
 	} else {
 		// last redial attempt was too recent; just dump to stderr for now
@@ -197,8 +304,62 @@ func (reconn *RedisConn) Write(b []byte) (n int, err error) {
 	return
 }
 
-func (reconn *RedisConn) dial() (net.Conn, error) {
-	return net.DialTimeout(reconn.nw.addr.Network, reconn.nw.addr.JoinHostPort(0), reconn.timeout)
+// backoff doubles the wait before the next redial attempt, bounded by
+// the configured interval range. The actual wait is randomly chosen
+// between half and all of that interval so that many writers failing
+// at once don't all redial in lockstep.
+func (reconn *RedisConn) backoff() {
+	minInterval := time.Duration(reconn.nw.ReconnectMinInterval)
+	maxInterval := time.Duration(reconn.nw.ReconnectMaxInterval)
+
+	base := reconn.backoffBase * 2
+	if base < minInterval {
+		base = minInterval
+	}
+	if base > maxInterval {
+		base = maxInterval
+	}
+	reconn.backoffBase = base
+
+	half := base / 2
+	reconn.redialDelay = half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// push issues an LPUSH of one log line. The trailing newline
+// added by the log encoder is not stored in the list.
+func (reconn *RedisConn) push(client *redis.Client, b []byte) (int, error) {
+	line := bytes.TrimSuffix(b, []byte("\n"))
+	if err := client.LPush(context.Background(), reconn.nw.RedisKey, line).Err(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the underlying Redis client.
+func (reconn *RedisConn) Close() error {
+	reconn.connMu.Lock()
+	defer reconn.connMu.Unlock()
+	if reconn.client == nil {
+		return nil
+	}
+	return reconn.client.Close()
+}
+
+// dial creates a new Redis client and makes sure the server is reachable.
+func (reconn *RedisConn) dial() (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Network:     reconn.nw.addr.Network,
+		Addr:        reconn.nw.addr.JoinHostPort(0),
+		Username:    reconn.nw.RedisUsername,
+		Password:    reconn.nw.RedisPassword,
+		DB:          reconn.nw.RedisDB,
+		DialTimeout: reconn.timeout,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
 }
 
 // Interface guards
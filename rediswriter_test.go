@@ -0,0 +1,185 @@
+package logging
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// newTestWriter provisions a RedisWriter pointed at mr.
+func newTestWriter(t *testing.T, mr *miniredis.Miniredis) *RedisWriter {
+	t.Helper()
+	nw := &RedisWriter{Address: mr.Addr(), RedisKey: "caddy_logs"}
+	if err := nw.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	return nw
+}
+
+func TestWriterPushesLines(t *testing.T) {
+	mr := miniredis.RunT(t)
+	w, err := newTestWriter(t, mr).OpenWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{`{"msg":"first"}` + "\n", `{"msg":"second"}` + "\n"} {
+		n, err := w.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(line) {
+			t.Errorf("Write returned %d, want %d", n, len(line))
+		}
+	}
+
+	got, err := mr.List("caddy_logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{"msg":"second"}`, `{"msg":"first"}`}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("list = %q, want %q", got, want)
+	}
+}
+
+func TestWriterOpenFailsWhenDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	nw := newTestWriter(t, mr)
+	mr.Close()
+
+	if _, err := nw.OpenWriter(); err == nil {
+		t.Error("expected OpenWriter to fail without soft_start")
+	}
+
+	nw.SoftStart = true
+	w, err := nw.OpenWriter()
+	if err != nil {
+		t.Fatalf("soft_start should tolerate an unreachable server: %v", err)
+	}
+	w.Close()
+}
+
+func TestWriterCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`redislogger localhost:6379 {
+		redis_key caddy_logs
+		redis_username logger
+		redis_password secret
+		redis_db 3
+		dial_timeout 2s
+		reconnect_min_interval 500ms
+		reconnect_max_interval 1m
+		soft_start
+	}`)
+	var nw RedisWriter
+	if err := nw.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	want := RedisWriter{
+		Address:              "localhost:6379",
+		RedisKey:             "caddy_logs",
+		RedisUsername:        "logger",
+		RedisPassword:        "secret",
+		RedisDB:              3,
+		DialTimeout:          caddy.Duration(2 * time.Second),
+		ReconnectMinInterval: caddy.Duration(500 * time.Millisecond),
+		ReconnectMaxInterval: caddy.Duration(time.Minute),
+		SoftStart:            true,
+	}
+	if !reflect.DeepEqual(nw, want) {
+		t.Errorf("parsed %+v, want %+v", nw, want)
+	}
+
+	if err := nw.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`redislogger localhost:6379 {
+		redis_db one
+	}`)); err == nil {
+		t.Error("expected a non-numeric redis_db to be rejected")
+	}
+}
+
+func TestWriterProvisionValidates(t *testing.T) {
+	for name, nw := range map[string]RedisWriter{
+		"missing key":  {Address: "localhost:6379"},
+		"negative db":  {Address: "localhost:6379", RedisKey: "logs", RedisDB: -1},
+		"port range":   {Address: "localhost:6379-6380", RedisKey: "logs"},
+		"min over max": {Address: "localhost:6379", RedisKey: "logs", ReconnectMinInterval: caddy.Duration(time.Minute), ReconnectMaxInterval: caddy.Duration(time.Second)},
+	} {
+		if err := nw.Provision(caddy.Context{}); err == nil {
+			t.Errorf("%s: expected Provision to fail", name)
+		}
+	}
+}
+
+func TestWriterReconnectBackoff(t *testing.T) {
+	mr := miniredis.RunT(t)
+	nw := newTestWriter(t, mr)
+	nw.ReconnectMinInterval = caddy.Duration(time.Second)
+	nw.ReconnectMaxInterval = caddy.Duration(4 * time.Second)
+	w, err := nw.OpenWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	reconn := w.(*RedisConn)
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reconn.now = func() time.Time { return clock }
+
+	// lines that can't be pushed go to stderr, keep the test output clean
+	stderr := os.Stderr
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = devNull
+	defer func() { os.Stderr = stderr; devNull.Close() }()
+
+	mr.Close()
+
+	// each failed redial doubles the base up to the maximum, and the
+	// actual wait is jittered between half and all of the base
+	for _, base := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		redialed := clock
+		reconn.Write([]byte("line\n"))
+		if !reconn.lastRedial.Equal(redialed) {
+			t.Fatalf("expected a redial at %s", redialed)
+		}
+		if reconn.backoffBase != base {
+			t.Errorf("backoff base = %s, want %s", reconn.backoffBase, base)
+		}
+		delay := reconn.redialDelay
+		if delay < base/2 || delay > base {
+			t.Errorf("redial delay %s outside [%s, %s]", delay, base/2, base)
+		}
+
+		// writes before the delay has passed don't redial
+		clock = redialed.Add(delay)
+		reconn.Write([]byte("line\n"))
+		if !reconn.lastRedial.Equal(redialed) {
+			t.Errorf("redialed %s after the last attempt, before the %s delay", delay, delay)
+		}
+		clock = clock.Add(time.Millisecond)
+	}
+
+	// once Redis is back, a successful redial resets the backoff; close the
+	// old client so the write can't recover through its connection pool
+	reconn.client.Close()
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconn.Write([]byte("back\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mr.List("caddy_logs"); len(got) != 1 || got[0] != "back" {
+		t.Errorf("list = %q, want [back]", got)
+	}
+	if reconn.backoffBase != 0 || reconn.redialDelay != 0 {
+		t.Errorf("backoff not reset: base %s, delay %s", reconn.backoffBase, reconn.redialDelay)
+	}
+}